@@ -0,0 +1,47 @@
+import type { Handler } from "./handler";
+import type { Logger } from "./log";
+
+/**
+ * Log method, path, status, body bytes and latency for every request. The
+ * record is written once the body has been fully sent, so streamed and
+ * compressed responses report what actually went over the wire.
+ */
+export function withAccessLog(
+  next: Handler,
+  log: Logger,
+  now: () => number = performance.now.bind(performance),
+): Handler {
+  return async (req) => {
+    const start = now();
+    const { pathname } = new URL(req.url);
+    const res = await next(req);
+    const record = (bytes: number): void => {
+      log.info(`${req.method} ${pathname}`, {
+        status: res.status,
+        bytes,
+        ms: Math.round((now() - start) * 10) / 10,
+      });
+    };
+    if (res.body === null) {
+      record(0);
+      return res;
+    }
+    let bytes = 0;
+    const counted = res.body.pipeThrough(
+      new TransformStream<Uint8Array, Uint8Array>({
+        transform(chunk, controller) {
+          bytes += chunk.byteLength;
+          controller.enqueue(chunk);
+        },
+        flush() {
+          record(bytes);
+        },
+      }),
+    );
+    return new Response(counted, {
+      status: res.status,
+      statusText: res.statusText,
+      headers: res.headers,
+    });
+  };
+}
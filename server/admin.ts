@@ -0,0 +1,104 @@
+import { createHash, timingSafeEqual } from "node:crypto";
+import process from "node:process";
+import type { Handler } from "./handler";
+
+function digest(s: string): Buffer {
+  return createHash("sha256").update(s).digest();
+}
+
+/** Check an `Authorization: Bearer <token>` header in constant time. */
+export function authorized(header: string | null, token: string): boolean {
+  const match = /^Bearer (.+)$/u.exec(header ?? "");
+  // Hashing first gives both sides the same length, as timingSafeEqual needs.
+  return match !== null && timingSafeEqual(digest(match[1]!), digest(token));
+}
+
+/** Check an `Authorization: Basic` header against `user` and `pass`. */
+export function basicAuthorized(
+  header: string | null,
+  user: string,
+  pass: string,
+): boolean {
+  const match = /^Basic ([A-Za-z0-9+/=]+)$/u.exec(header ?? "");
+  if (match === null) {
+    return false;
+  }
+  const given = Buffer.from(match[1]!, "base64").toString("utf-8");
+  return timingSafeEqual(digest(given), digest(`${user}:${pass}`));
+}
+
+/** Ask for `user`/`pass` before letting a request through to `next`. */
+export function withBasicAuth(
+  next: Handler,
+  user: string,
+  pass: string,
+): Handler {
+  return (req) =>
+    basicAuthorized(req.headers.get("Authorization"), user, pass)
+      ? next(req)
+      : new Response("Unauthorized", {
+          status: 401,
+          headers: {
+            "WWW-Authenticate": 'Basic realm="brainbout", charset="UTF-8"',
+          },
+        });
+}
+
+/** Wrap `next` so it only runs for a `method` carrying the admin token. */
+export function adminOnly(
+  token: string,
+  next: Handler,
+  method = "POST",
+): Handler {
+  return (req) => {
+    if (req.method !== method) {
+      return new Response("Method not allowed", {
+        status: 405,
+        headers: { Allow: method },
+      });
+    }
+    if (!authorized(req.headers.get("Authorization"), token)) {
+      return new Response("Unauthorized", {
+        status: 401,
+        headers: { "WWW-Authenticate": "Bearer" },
+      });
+    }
+    return next(req);
+  };
+}
+
+/** Answer 200, then run `shutdown` once the response is on its way. */
+export function shutdownHandler(shutdown: () => void): Handler {
+  return () => {
+    setTimeout(shutdown, 0);
+    return Response.json({ status: "shutting down" });
+  };
+}
+
+/** What the server knows about its own connections. */
+export interface Connections {
+  websockets: number;
+  pendingRequests: number;
+}
+
+/** Uptime, runtime, memory and connection counts as JSON. */
+export function statsHandler(
+  connections: () => Connections,
+  started = Date.now(),
+  now = Date.now,
+): Handler {
+  return () => {
+    const memory = process.memoryUsage();
+    return Response.json({
+      uptimeSeconds: Math.floor((now() - started) / 1000),
+      runtime: `bun ${process.versions.bun ?? "unknown"}`,
+      pid: process.pid,
+      memory: {
+        rssBytes: memory.rss,
+        heapUsedBytes: memory.heapUsed,
+        heapTotalBytes: memory.heapTotal,
+      },
+      ...connections(),
+    });
+  };
+}
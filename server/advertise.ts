@@ -0,0 +1,77 @@
+import { createSocket } from "node:dgram";
+import type { Logger } from "./log";
+import {
+  asksForUs,
+  encodeResponse,
+  GROUP,
+  HOST,
+  MDNS_PORT,
+  parseQuestions,
+  records,
+  SERVICE,
+  TTL,
+} from "./mdns";
+
+export interface Advertisement {
+  stop: () => Promise<void>;
+}
+
+/**
+ * Advertise brainbout on the local network. Best-effort: any failure is
+ * logged as a warning and the server keeps running without it.
+ */
+export function advertise(
+  port: number,
+  addresses: string[],
+  log: Logger,
+): Advertisement {
+  const socket = createSocket({ type: "udp4", reuseAddr: true });
+  let open = true;
+  const close = (): void => {
+    if (open) {
+      open = false;
+      socket.close();
+    }
+  };
+  const send = (ttl: number): Promise<void> =>
+    new Promise((resolve) => {
+      if (!open) {
+        resolve();
+        return;
+      }
+      const packet = encodeResponse(records(port, addresses, ttl));
+      socket.send(packet, MDNS_PORT, GROUP, () => {
+        resolve();
+      });
+    });
+
+  socket.on("error", (err) => {
+    log.warn("mDNS advertisement failed", { err: err.message });
+    close();
+  });
+  socket.on("message", (msg) => {
+    if (asksForUs(parseQuestions(msg))) {
+      void send(TTL);
+    }
+  });
+  socket.bind(MDNS_PORT, () => {
+    try {
+      socket.addMembership(GROUP);
+    } catch (err) {
+      log.warn("mDNS advertisement failed", { err: (err as Error).message });
+      close();
+      return;
+    }
+    log.info(`Advertising ${HOST} over mDNS`, { service: SERVICE, port });
+    // RFC 6762 §8.3: announce twice, a second apart.
+    void send(TTL);
+    setTimeout(() => void send(TTL), 1000).unref();
+  });
+
+  return {
+    stop: async () => {
+      await send(0);
+      close();
+    },
+  };
+}
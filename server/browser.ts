@@ -0,0 +1,114 @@
+import { spawn } from "node:child_process";
+import { delimiter } from "node:path";
+import process from "node:process";
+
+/**
+ * Split a command line into arguments on whitespace, honouring single and
+ * double quotes. Nothing is expanded: the result is run without a shell.
+ */
+export function splitCommand(line: string): string[] {
+  return [...line.matchAll(/(?:"[^"]*"|'[^']*'|[^\s"'])+/gu)].map((m) =>
+    m[0].replace(/"([^"]*)"|'([^']*)'/gu, "$1$2"),
+  );
+}
+
+/** `template` with `%s` replaced by `url`, or `url` appended if absent. */
+export function commandFor(template: string, url: string): string[] {
+  const args = splitCommand(template);
+  return args.some((a) => a.includes("%s"))
+    ? args.map((a) => a.replaceAll("%s", url))
+    : [...args, url];
+}
+
+/**
+ * `arg` with cmd.exe's metacharacters caret-escaped, so that `start` gets
+ * a URL with `&` in its query whole instead of running the rest of it.
+ */
+export function cmdEscape(arg: string): string {
+  return arg.replace(/[\^&|<>()]/gu, "^$&");
+}
+
+/**
+ * Commands that may open `url`, best first. A `custom` command (--browser)
+ * is the only one tried; otherwise each `$BROWSER` entry, then the
+ * platform's usual openers.
+ */
+export function browserCommands(
+  url: string,
+  custom = "",
+  platform: NodeJS.Platform = process.platform,
+  env: NodeJS.ProcessEnv = process.env,
+): string[][] {
+  if (custom.trim() !== "") {
+    return [commandFor(custom, url)];
+  }
+  const fromEnv = (env.BROWSER ?? "")
+    .split(delimiter)
+    .filter((cmd) => cmd.trim() !== "")
+    .map((cmd) => commandFor(cmd, url));
+  const defaults =
+    platform === "darwin"
+      ? [["open", url]]
+      : platform === "win32"
+        ? [
+            ["cmd", "/c", "start", "", cmdEscape(url)],
+            ["rundll32", "url.dll,FileProtocolHandler", url],
+          ]
+        : [
+            ["xdg-open", url],
+            ["gio", "open", url],
+            ["sensible-browser", url],
+          ];
+  return [...fromEnv, ...defaults];
+}
+
+/** Start `cmd` in the background; false if it could not be started. */
+export function spawnDetached(cmd: string[]): Promise<boolean> {
+  return new Promise((resolve) => {
+    const child = spawn(cmd[0]!, cmd.slice(1), {
+      stdio: "ignore",
+      detached: true,
+    });
+    child.on("spawn", () => {
+      child.unref();
+      resolve(true);
+    });
+    child.on("error", () => {
+      resolve(false);
+    });
+  });
+}
+
+/**
+ * Try `commands` in order and resolve with the first that starts. Rejects,
+ * naming every attempt, when none does.
+ */
+export async function openBrowser(
+  commands: string[][],
+  start: (cmd: string[]) => Promise<boolean> = spawnDetached,
+): Promise<string[]> {
+  for (const cmd of commands) {
+    if (await start(cmd)) {
+      return cmd;
+    }
+  }
+  const tried = commands.map((cmd) => cmd[0]).join(", ");
+  throw new Error(`no browser command could be started (tried ${tried})`);
+}
+
+/** `text` as an OSC 8 terminal hyperlink to `url`. */
+export function hyperlink(url: string, text = url): string {
+  return `\u001b]8;;${url}\u001b\\${text}\u001b]8;;\u001b\\`;
+}
+
+/**
+ * A box around "Open <url>" for when no browser could be started, so the
+ * address stands out from the log. `link` makes it clickable in terminals
+ * that understand OSC 8; others show the plain text.
+ */
+export function urlBanner(url: string, link: boolean): string {
+  const text = `Open ${link ? hyperlink(url) : url}`;
+  // Escape sequences take no columns, so measure the plain text.
+  const rule = `+${"-".repeat(`Open ${url}`.length + 4)}+`;
+  return [rule, `|  ${text}  |`, rule].join("\n");
+}
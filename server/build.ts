@@ -1,4 +1,4 @@
-import { mkdtempSync, writeFileSync } from "node:fs";
+import { mkdtempSync, readFileSync, writeFileSync } from "node:fs";
 import { tmpdir } from "node:os";
 import { join, relative } from "node:path";
 import process from "node:process";
@@ -11,6 +11,11 @@ const files = Array.from(
   new Glob("**/*").scanSync({ cwd: DIST, onlyFiles: true }),
 );
 
+if (!files.includes("index.html")) {
+  console.error('dist has no index.html; run "bun run build" first');
+  process.exit(1);
+}
+
 const dir = mkdtempSync(join(tmpdir(), "brainbout-"));
 const entry = join(dir, "entry.ts");
 
@@ -32,38 +37,25 @@ writeFileSync(
   entry,
   `// @ts-nocheck
 ${imports}
-import { spawn } from "node:child_process";
-import process from "node:process";
-import { file, serve } from "bun";
+import { main } from "${relative(dir, join(import.meta.dirname, "main.ts"))}";
 
-const routes: Record<string, string> = {
+main({
 ${routes}
-};
-
-const HEADERS = {
-  "Cross-Origin-Opener-Policy": "same-origin",
-  "Cross-Origin-Embedder-Policy": "require-corp",
-};
-
-serve({
-  port: 8960,
-  hostname: "127.0.0.1",
-  fetch(req: Request) {
-    const { pathname } = new URL(req.url);
-    const path = routes[pathname] ?? routes["/index.html"];
-    return path ? new Response(file(path), { headers: HEADERS }) : new Response("Not found", { status: 404 });
-  },
 });
-
-const url = "http://127.0.0.1:8960";
-const opener =
-  process.platform === "darwin" ? ["open", url]
-  : process.platform === "win32" ? ["cmd", "/c", "start", url]
-  : ["xdg-open", url];
-spawn(opener[0]!, opener.slice(1), { stdio: "ignore", detached: true }).unref();
 `,
 );
 
+const pkg = JSON.parse(readFileSync(join(ROOT, "package.json"), "utf-8")) as {
+  version: string;
+};
+const rev = Bun.spawnSync({ cmd: ["git", "rev-parse", "--short", "HEAD"] });
+const commit = rev.exitCode === 0 ? rev.stdout.toString().trim() : "unknown";
+const defines = {
+  __BB_VERSION__: pkg.version,
+  __BB_COMMIT__: commit,
+  __BB_BUILD_DATE__: new Date().toISOString(),
+};
+
 const TARGETS: Record<string, string> = {
   "brainbout-linux-amd64": "bun-linux-x64",
   "brainbout-windows-amd64.exe": "bun-windows-x64",
@@ -92,6 +84,10 @@ for (const { outfile, target } of builds) {
       "--compile",
       `--target=${target}`,
       "--minify",
+      ...Object.entries(defines).flatMap(([k, v]) => [
+        "--define",
+        `${k}=${JSON.stringify(v)}`,
+      ]),
       entry,
       "--outfile",
       join(ROOT, outfile),
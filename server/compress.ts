@@ -0,0 +1,86 @@
+import { createHash } from "node:crypto";
+import { brotliCompressSync, constants, gzipSync } from "node:zlib";
+import type { Handler } from "./handler";
+
+export type Encoding = "br" | "gzip";
+
+const COMPRESSIBLE =
+  /^(?:text\/|application\/(?:javascript|json|manifest\+json|wasm)|image\/svg\+xml)/u;
+
+// Below this the headers cost more than the bytes saved.
+const MIN_SIZE = 1024;
+
+/** Pick the best encoding the client accepts, preferring brotli. */
+export function negotiate(acceptEncoding: string | null): Encoding | null {
+  const q = new Map<string, number>();
+  for (const part of (acceptEncoding ?? "").split(",")) {
+    const [name = "", ...params] = part.trim().toLowerCase().split(";");
+    const qParam = params.find((p) => p.trim().startsWith("q="));
+    q.set(name, qParam === undefined ? 1 : Number(qParam.trim().slice(2)));
+  }
+  const accepts = (enc: Encoding): boolean =>
+    (q.get(enc) ?? q.get("*") ?? 0) > 0;
+  if (accepts("br")) {
+    return "br";
+  }
+  return accepts("gzip") ? "gzip" : null;
+}
+
+function compress(body: Uint8Array, encoding: Encoding): Uint8Array {
+  return encoding === "br"
+    ? brotliCompressSync(body, {
+        params: { [constants.BROTLI_PARAM_QUALITY]: 8 },
+      })
+    : gzipSync(body);
+}
+
+/**
+ * Compress text-like responses (never images, audio or partial content).
+ * Output is cached, so the multi-megabyte dictionary is only compressed once
+ * per encoding. For assets that never change, `memoKey` names the file a
+ * request resolves to and a cache hit skips reading the body at all; files
+ * served from disk are cached by content hash instead.
+ */
+export function withCompression(
+  next: Handler,
+  cache = new Map<string, Uint8Array>(),
+  memoKey?: (req: Request) => string | undefined,
+): Handler {
+  return async (req) => {
+    const res = await next(req);
+    const encoding = negotiate(req.headers.get("Accept-Encoding"));
+    const type = res.headers.get("Content-Type") ?? "";
+    if (
+      encoding === null ||
+      req.headers.has("Range") ||
+      res.status !== 200 ||
+      res.headers.has("Content-Encoding") ||
+      !COMPRESSIBLE.test(type)
+    ) {
+      return res;
+    }
+    const headers = new Headers(res.headers);
+    headers.append("Vary", "Accept-Encoding");
+    const asset = memoKey?.(req);
+    let key = asset === undefined ? undefined : `${asset}:${encoding}`;
+    let out = key === undefined ? undefined : cache.get(key);
+    if (out === undefined) {
+      const body = new Uint8Array(await res.arrayBuffer());
+      if (body.length < MIN_SIZE) {
+        return new Response(body, { status: res.status, headers });
+      }
+      key ??= `${createHash("sha1").update(body).digest("hex")}:${encoding}`;
+      out = cache.get(key);
+      if (out === undefined) {
+        out = compress(body, encoding);
+        cache.set(key, out);
+      }
+    } else {
+      await res.body?.cancel();
+    }
+    headers.set("Content-Encoding", encoding);
+    headers.delete("Content-Length");
+    headers.delete("Accept-Ranges");
+    return new Response(out, { status: res.status, headers });
+  };
+}
@@ -0,0 +1,55 @@
+import type { Handler } from "./handler";
+
+const ALLOW_METHODS = "GET, POST, OPTIONS";
+const ALLOW_HEADERS = "Authorization, Content-Type";
+const MAX_AGE = "600";
+
+/** Whether `raw` is a bare origin such as `https://example.com:8443`. */
+export function isOrigin(raw: string): boolean {
+  try {
+    const url = new URL(raw);
+    return /^https?:$/u.test(url.protocol) && url.origin === raw;
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Let pages on `origins` call the API under `prefixes`, answering their
+ * preflights here. Other origins and other paths (the static assets) get
+ * no CORS headers at all, so browsers keep them same-origin.
+ */
+export function withCors(
+  next: Handler,
+  origins: readonly string[],
+  prefixes = ["/api/"],
+): Handler {
+  const allowed = new Set(origins);
+  return async (req) => {
+    const origin = req.headers.get("Origin") ?? "";
+    const { pathname } = new URL(req.url);
+    const api = prefixes.some((p) => pathname.startsWith(p));
+    if (!api || !allowed.has(origin)) {
+      return next(req);
+    }
+    if (
+      req.method === "OPTIONS" &&
+      req.headers.has("Access-Control-Request-Method")
+    ) {
+      return new Response(null, {
+        status: 204,
+        headers: {
+          "Access-Control-Allow-Origin": origin,
+          Vary: "Origin",
+          "Access-Control-Allow-Methods": ALLOW_METHODS,
+          "Access-Control-Allow-Headers": ALLOW_HEADERS,
+          "Access-Control-Max-Age": MAX_AGE,
+        },
+      });
+    }
+    const res = await next(req);
+    res.headers.set("Access-Control-Allow-Origin", origin);
+    res.headers.append("Vary", "Origin");
+    return res;
+  };
+}
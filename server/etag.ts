@@ -0,0 +1,66 @@
+import { createHash } from "node:crypto";
+import type { Handler } from "./handler";
+
+export function etagFor(body: Uint8Array): string {
+  const hash = createHash("sha256").update(body).digest("base64url");
+  return `"${hash.slice(0, 22)}"`;
+}
+
+/** Whether an If-None-Match header matches `etag` (weak comparison). */
+export function noneMatch(header: string | null, etag: string): boolean {
+  if (header === null) {
+    return false;
+  }
+  const bare = (tag: string): string => tag.trim().replace(/^W\//u, "");
+  return header.split(",").some((t) => t.trim() === "*" || bare(t) === etag);
+}
+
+/**
+ * Give 200 responses a strong ETag from their content and answer matching
+ * If-None-Match requests with 304. It wraps compression, so each encoding
+ * gets its own tag. For assets that never change, `memoKey` names the file
+ * a request resolves to, and its tag is hashed once per file and encoding;
+ * keying on the file rather than the path keeps the memo as small as the
+ * set of files. Without it, tags are hashed on every request.
+ */
+export function withEtag(
+  next: Handler,
+  memoKey?: (req: Request) => string | undefined,
+): Handler {
+  const tags = new Map<string, string>();
+  return async (req) => {
+    const res = await next(req);
+    if (
+      (req.method !== "GET" && req.method !== "HEAD") ||
+      res.status !== 200 ||
+      res.headers.has("ETag")
+    ) {
+      return res;
+    }
+    const asset = memoKey?.(req);
+    // What was sent, not what was asked for: Range requests skip compression.
+    const key =
+      asset === undefined
+        ? undefined
+        : `${asset}:${res.headers.get("Content-Encoding") ?? ""}`;
+    let etag = key === undefined ? undefined : tags.get(key);
+    let body: Uint8Array | null = null;
+    if (etag === undefined) {
+      body = new Uint8Array(await res.arrayBuffer());
+      etag = etagFor(body);
+      if (key !== undefined) {
+        tags.set(key, etag);
+      }
+    }
+    const headers = new Headers(res.headers);
+    headers.set("ETag", etag);
+    if (noneMatch(req.headers.get("If-None-Match"), etag)) {
+      if (body === null) {
+        await res.body?.cancel();
+      }
+      headers.delete("Content-Length");
+      return new Response(null, { status: 304, headers });
+    }
+    return new Response(body ?? res.body, { status: 200, headers });
+  };
+}
@@ -0,0 +1,154 @@
+import { statSync } from "node:fs";
+import { stat } from "node:fs/promises";
+import { join, resolve, sep } from "node:path";
+import { file } from "bun";
+import { BUILD } from "./version";
+
+export type Handler = (req: Request) => Response | Promise<Response>;
+
+export const ISOLATION_HEADERS = {
+  "Cross-Origin-Opener-Policy": "same-origin",
+  "Cross-Origin-Embedder-Policy": "require-corp",
+};
+
+/** Cheap protections for an instance that may be reachable on a LAN. */
+export const HARDENING_HEADERS = {
+  "X-Content-Type-Options": "nosniff",
+  "Referrer-Policy": "no-referrer",
+};
+
+/** Route exact paths to their handler and everything else to `fallback`. */
+export function mux(
+  routes: Record<string, Handler>,
+  fallback: Handler,
+): Handler {
+  return (req) => {
+    const { pathname } = new URL(req.url);
+    return (routes[pathname] ?? fallback)(req);
+  };
+}
+
+export function withHeaders(
+  next: Handler,
+  headers: Record<string, string>,
+): Handler {
+  return async (req) => {
+    const res = await next(req);
+    for (const [k, v] of Object.entries(headers)) {
+      res.headers.set(k, v);
+    }
+    return res;
+  };
+}
+
+/** The embedded file `assets` serves for `pathname`. */
+export function assetFor(
+  files: Record<string, string>,
+  pathname: string,
+): string | undefined {
+  return files[pathname] ?? files["/index.html"];
+}
+
+/** Serve embedded files by path, falling back to index.html. */
+export function assets(files: Record<string, string>): Handler {
+  return (req) => {
+    const path = assetFor(files, new URL(req.url).pathname);
+    return path
+      ? new Response(file(path))
+      : new Response("Not found", { status: 404 });
+  };
+}
+
+async function isFile(path: string): Promise<boolean> {
+  try {
+    return (await stat(path)).isFile();
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Where `pathname` lives under `base`, or null if it would escape it.
+ * Throws URIError for malformed escapes.
+ */
+function underRoot(base: string, pathname: string): string | null {
+  const path = resolve(base, `.${decodeURIComponent(pathname)}`);
+  return path === base || path.startsWith(base + sep) ? path : null;
+}
+
+/**
+ * Serve files from `root` on disk, falling back to index.html like
+ * {@link assets}. Files are looked up per request, so edits show on reload.
+ */
+export function directory(root: string): Handler {
+  const base = resolve(root);
+  const index = join(base, "index.html");
+  return async (req) => {
+    let path: string | null;
+    try {
+      path = underRoot(base, new URL(req.url).pathname);
+    } catch {
+      return new Response("Bad request", { status: 400 });
+    }
+    if (path === null) {
+      return new Response("Not found", { status: 404 });
+    }
+    if (await isFile(path)) {
+      return new Response(file(path));
+    }
+    return (await isFile(index))
+      ? new Response(file(index))
+      : new Response("Not found", { status: 404 });
+  };
+}
+
+/**
+ * Serve the files that exist under `root` and pass everything else to
+ * `next`, so a theme or a page can be swapped without a rebuild. Paths
+ * escaping `root` are never looked up there.
+ */
+export function overlay(root: string, next: Handler): Handler {
+  const base = resolve(root);
+  return async (req) => {
+    let path: string | null;
+    try {
+      const { pathname } = new URL(req.url);
+      const name = pathname.endsWith("/") ? `${pathname}index.html` : pathname;
+      path = underRoot(base, name);
+    } catch {
+      return new Response("Bad request", { status: 400 });
+    }
+    return path !== null && (await isFile(path))
+      ? new Response(file(path))
+      : next(req);
+  };
+}
+
+/**
+ * Why there is no index.html to serve, or "" if there is. Checked at
+ * startup, so a bad build fails with a reason instead of serving 404s.
+ */
+export function missingIndex(
+  routes: Record<string, string>,
+  devDir: string,
+): string {
+  if (devDir === "") {
+    return routes["/index.html"] === undefined
+      ? 'no web assets are embedded in this binary; build it with "bun run build:server", which builds dist first'
+      : "";
+  }
+  const index = statSync(join(devDir, "index.html"), {
+    throwIfNoEntry: false,
+  });
+  return index?.isFile()
+    ? ""
+    : `no index.html in --dev-dir ${devDir}; run "bun run build" and point it at dist`;
+}
+
+export function healthz(): Response {
+  return Response.json({ status: "ok" });
+}
+
+export function version(): Response {
+  return Response.json(BUILD);
+}
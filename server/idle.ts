@@ -0,0 +1,47 @@
+import type { Handler } from "./handler";
+
+export interface IdleTimer {
+  touch: () => void;
+  stop: () => void;
+}
+
+/**
+ * Call `onIdle` once no {@link IdleTimer.touch} has happened for `timeoutMs`.
+ * Checks run a few times per timeout, so it fires slightly late, never early.
+ */
+export function createIdleTimer(
+  timeoutMs: number,
+  onIdle: () => void,
+  now: () => number = Date.now,
+): IdleTimer {
+  let last = now();
+  const id = setInterval(
+    () => {
+      if (now() - last >= timeoutMs) {
+        clearInterval(id);
+        onIdle();
+      }
+    },
+    Math.max(1000, timeoutMs / 10),
+  );
+  return {
+    touch: () => {
+      last = now();
+    },
+    stop: () => {
+      clearInterval(id);
+    },
+  };
+}
+
+/** Count every request, start and finish, as activity on `timer`. */
+export function withActivity(next: Handler, timer: IdleTimer): Handler {
+  return async (req) => {
+    timer.touch();
+    try {
+      return await next(req);
+    } finally {
+      timer.touch();
+    }
+  };
+}
@@ -0,0 +1,162 @@
+import {
+  linkSync,
+  readFileSync,
+  renameSync,
+  rmSync,
+  statSync,
+  writeFileSync,
+} from "node:fs";
+import { tmpdir } from "node:os";
+import { join } from "node:path";
+import process from "node:process";
+
+export interface LockInfo {
+  pid: number;
+  url: string;
+}
+
+export interface InstanceLock {
+  /** Record where this instance is serving, for later launches to find. */
+  publish: (url: string) => void;
+  release: () => void;
+}
+
+export type LockResult =
+  | { ok: true; lock: InstanceLock }
+  | { ok: false; holder: LockInfo };
+
+function code(err: unknown): unknown {
+  return (err as { code?: unknown } | null)?.code;
+}
+
+export function processAlive(pid: number): boolean {
+  try {
+    process.kill(pid, 0);
+    return true;
+  } catch (err) {
+    // EPERM: it exists but belongs to someone else.
+    return code(err) === "EPERM";
+  }
+}
+
+/**
+ * Where the lock for `port` lives: the per-user runtime directory when
+ * there is one, else the temp directory with the uid in the name, so other
+ * users of a shared /tmp can't plant a lock for us to obey.
+ */
+export function lockPath(
+  port: number,
+  env: NodeJS.ProcessEnv = process.env,
+  // Windows has no uid, and no shared temp directory either.
+  uid: number | null = process.getuid?.() ?? null,
+): string {
+  const name = `brainbout-${String(port)}.lock`;
+  if (env.XDG_RUNTIME_DIR) {
+    return join(env.XDG_RUNTIME_DIR, name);
+  }
+  return join(tmpdir(), uid === null ? name : `${String(uid)}-${name}`);
+}
+
+// A lock is never partly written (see writeAtomic), so one that can't be
+// read was damaged; give it this long in case it is being replaced.
+const UNREADABLE_GRACE_MS = 10_000;
+
+function readLock(path: string): LockInfo | null {
+  try {
+    const info = JSON.parse(readFileSync(path, "utf-8")) as Partial<LockInfo>;
+    return typeof info.pid === "number"
+      ? { pid: info.pid, url: info.url ?? "" }
+      : null;
+  } catch {
+    return null;
+  }
+}
+
+/** Write `text` beside `path`, then rename it into place. */
+function writeAtomic(path: string, text: string, pid: number): void {
+  const tmp = `${path}.${String(pid)}.tmp`;
+  writeFileSync(tmp, text);
+  renameSync(tmp, path);
+}
+
+/**
+ * Create `path` holding `text`, failing with EEXIST if it exists. Linking a
+ * finished file into place means nobody ever sees it empty, as they could
+ * between an exclusive open and the write that follows it.
+ */
+function createAtomic(path: string, text: string, pid: number): void {
+  const tmp = `${path}.${String(pid)}.tmp`;
+  writeFileSync(tmp, text);
+  try {
+    linkSync(tmp, path);
+  } finally {
+    rmSync(tmp, { force: true });
+  }
+}
+
+/** Whether a lock whose holder can't be read may be taken over. */
+function abandoned(path: string, now: number): boolean {
+  const mtime = statSync(path, { throwIfNoEntry: false })?.mtimeMs ?? 0;
+  return now - mtime >= UNREADABLE_GRACE_MS;
+}
+
+/**
+ * Take the single-instance lock at `path`. The lock file is created
+ * atomically and exclusively, which behaves the same on every platform; a
+ * lock left behind by a process that no longer exists is reclaimed, and so
+ * is one left unreadable for a while.
+ */
+export function acquireLock(
+  path: string,
+  pid = process.pid,
+  isAlive = processAlive,
+  now = Date.now,
+): LockResult {
+  for (let attempt = 0; ; attempt++) {
+    try {
+      createAtomic(path, JSON.stringify({ pid, url: "" }), pid);
+      break;
+    } catch (err) {
+      if (code(err) !== "EEXIST" || attempt > 0) {
+        throw err;
+      }
+      const holder = readLock(path);
+      if (holder === null && !abandoned(path, now())) {
+        return { ok: false, holder: { pid: 0, url: "" } };
+      }
+      if (holder !== null && isAlive(holder.pid)) {
+        return { ok: false, holder };
+      }
+      rmSync(path, { force: true });
+    }
+  }
+  return {
+    ok: true,
+    lock: {
+      publish: (url) => {
+        writeAtomic(path, JSON.stringify({ pid, url }), pid);
+      },
+      release: () => {
+        if (readLock(path)?.pid === pid) {
+          rmSync(path, { force: true });
+        }
+      },
+    },
+  };
+}
+
+/**
+ * Write `url` to `path` for a script waiting to read it. It goes to a
+ * temporary file first and is renamed into place, so readers never see
+ * half a URL. Returns a function that removes the file again.
+ */
+export function writeAddrFile(
+  path: string,
+  url: string,
+  pid = process.pid,
+): () => void {
+  writeAtomic(path, `${url}\n`, pid);
+  return () => {
+    rmSync(path, { force: true });
+  };
+}
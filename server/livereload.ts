@@ -0,0 +1,67 @@
+import { watch } from "node:fs";
+import type { Handler } from "./handler";
+
+export const LIVERELOAD_PATH = "/ws/livereload";
+export const LIVERELOAD_TOPIC = "livereload";
+
+// Inline, so the CSP wrapper hashes it like the theme script.
+const SNIPPET =
+  "<script>" +
+  `new WebSocket(location.origin.replace(/^http/, "ws") + "${LIVERELOAD_PATH}")` +
+  ".onmessage = () => location.reload();" +
+  "</script>";
+
+export function injectSnippet(html: string): string {
+  const at = html.lastIndexOf("</body>");
+  return at < 0 ? html + SNIPPET : html.slice(0, at) + SNIPPET + html.slice(at);
+}
+
+/** Add the reload snippet to every HTML page `next` serves. */
+export function withLiveReload(next: Handler): Handler {
+  return async (req) => {
+    const res = await next(req);
+    if (!(res.headers.get("Content-Type") ?? "").startsWith("text/html")) {
+      return res;
+    }
+    const html = injectSnippet(await res.text());
+    const headers = new Headers(res.headers);
+    headers.delete("Content-Length");
+    return new Response(html, { status: res.status, headers });
+  };
+}
+
+export interface Debounced {
+  call: () => void;
+  cancel: () => void;
+}
+
+/** Run `fn` once `ms` after the last of a burst of calls. */
+export function debounce(fn: () => void, ms: number): Debounced {
+  let timer: ReturnType<typeof setTimeout> | undefined;
+  return {
+    call: () => {
+      clearTimeout(timer);
+      timer = setTimeout(fn, ms);
+    },
+    cancel: () => {
+      clearTimeout(timer);
+    },
+  };
+}
+
+/**
+ * Call `onChange` when anything under `dir` changes. Editors touch a file
+ * several times per save, so events are debounced. Returns a stop function.
+ */
+export function watchDir(
+  dir: string,
+  onChange: () => void,
+  ms = 100,
+): () => void {
+  const changed = debounce(onChange, ms);
+  const watcher = watch(dir, { recursive: true }, changed.call);
+  return () => {
+    watcher.close();
+    changed.cancel();
+  };
+}
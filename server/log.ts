@@ -0,0 +1,75 @@
+import process from "node:process";
+
+export const LEVELS = ["debug", "info", "warn", "error"] as const;
+export type Level = (typeof LEVELS)[number];
+
+export const FORMATS = ["text", "json"] as const;
+export type Format = (typeof FORMATS)[number];
+
+export type Attrs = Record<string, string | number | boolean>;
+
+export interface Logger {
+  debug: (msg: string, attrs?: Attrs) => void;
+  info: (msg: string, attrs?: Attrs) => void;
+  warn: (msg: string, attrs?: Attrs) => void;
+  error: (msg: string, attrs?: Attrs) => void;
+  /** Filter later records at `level` instead, e.g. after a config reload. */
+  setLevel: (level: Level) => void;
+}
+
+export interface LoggerOptions {
+  level: Level;
+  format: Format;
+  write?: (line: string) => void;
+  now?: () => Date;
+}
+
+function quote(v: string | number | boolean): string {
+  const s = String(v);
+  return s === "" || /[\s"=]/u.test(s) ? JSON.stringify(s) : s;
+}
+
+/**
+ * Text records read like plain log lines (`msg key=value ...`, with a level
+ * prefix only for warnings and errors); JSON records carry time and level.
+ */
+function format(
+  opts: LoggerOptions,
+  level: Level,
+  msg: string,
+  attrs: Attrs,
+): string {
+  if (opts.format === "json") {
+    const time = (opts.now?.() ?? new Date()).toISOString();
+    return JSON.stringify({ time, level, msg, ...attrs });
+  }
+  const prefix =
+    level === "warn" || level === "error" ? `${level.toUpperCase()} ` : "";
+  const pairs = Object.entries(attrs).map(([k, v]) => ` ${k}=${quote(v)}`);
+  return `${prefix}${msg}${pairs.join("")}`;
+}
+
+export function createLogger(opts: LoggerOptions): Logger {
+  const write =
+    opts.write ??
+    ((line: string) => {
+      process.stderr.write(`${line}\n`);
+    });
+  let min = LEVELS.indexOf(opts.level);
+  const at =
+    (level: Level) =>
+    (msg: string, attrs: Attrs = {}): void => {
+      if (LEVELS.indexOf(level) >= min) {
+        write(format(opts, level, msg, attrs));
+      }
+    };
+  return {
+    debug: at("debug"),
+    info: at("info"),
+    warn: at("warn"),
+    error: at("error"),
+    setLevel: (level) => {
+      min = LEVELS.indexOf(level);
+    },
+  };
+}
@@ -0,0 +1,509 @@
+import { chmodSync, rmSync } from "node:fs";
+import { isIPv4 } from "node:net";
+import { networkInterfaces } from "node:os";
+import process from "node:process";
+import { file, type ServerWebSocket, type TLSOptions } from "bun";
+import { withAccessLog } from "./access-log";
+import {
+  adminOnly,
+  shutdownHandler,
+  statsHandler,
+  withBasicAuth,
+} from "./admin";
+import { type Advertisement, advertise } from "./advertise";
+import { browserCommands, openBrowser, urlBanner } from "./browser";
+import { withCompression } from "./compress";
+import { withCors } from "./cors";
+import { withCsp } from "./csp";
+import { withEtag } from "./etag";
+import {
+  assetFor,
+  assets,
+  directory,
+  HARDENING_HEADERS,
+  type Handler,
+  healthz,
+  ISOLATION_HEADERS,
+  missingIndex,
+  mux,
+  overlay,
+  version,
+  withHeaders,
+} from "./handler";
+import { createIdleTimer, withActivity } from "./idle";
+import { acquireLock, lockPath, writeAddrFile } from "./instance";
+import {
+  LIVERELOAD_PATH,
+  LIVERELOAD_TOPIC,
+  watchDir,
+  withLiveReload,
+} from "./livereload";
+import { createLogger, type Logger } from "./log";
+import { createMetrics, metricsHandler, withMetrics } from "./metrics";
+import {
+  browseHost,
+  formatUrl,
+  hostPort,
+  isLocalUrl,
+  isLoopback,
+  lanAddresses,
+  listenError,
+  listenWithFallback,
+  PORT_ATTEMPTS,
+  pageUrl,
+  removeStaleSocket,
+  triedPort,
+} from "./network";
+import {
+  changedOptions,
+  LIVE_OPTIONS,
+  type Options,
+  parseOptions,
+  UsageError,
+} from "./options";
+import { qrCode } from "./qr";
+import { withRanges } from "./range";
+import { createRateLimiter, withRateLimit } from "./ratelimit";
+import { createServing, type Serving, upgrade } from "./serving";
+import { createSocketRegistry } from "./sockets";
+import { selfSignedCert } from "./tls";
+import { BUILD, versionString } from "./version";
+
+/**
+ * Open --open-path under `base` in a browser, or tell the user to do it if
+ * nothing works.
+ */
+function browse(base: string, opts: Options, log: Logger): void {
+  const url = pageUrl(base, opts.openPath);
+  log.info(`Opening ${url}`);
+  void openBrowser(browserCommands(url, opts.browser)).then(
+    (cmd) => {
+      log.debug("Browser opened", { cmd: cmd[0]! });
+    },
+    (err: unknown) => {
+      log.warn(`Could not open a browser, open ${url} yourself`, {
+        err: (err as Error).message,
+      });
+      // A box would break up JSON logs, which go to the same stream, and
+      // --quiet has already hidden the warning it goes with.
+      if (opts.logFormat === "text" && opts.logLevel !== "error") {
+        process.stderr.write(
+          `\n${urlBanner(url, process.stderr.isTTY === true)}\n\n`,
+        );
+      }
+    },
+  );
+}
+
+type Server = ReturnType<typeof Bun.serve>;
+
+// How long shutdown waits for pages to acknowledge the close frame.
+const SOCKET_CLOSE_MS = 1000;
+
+interface Listening {
+  server: Server;
+  /** Where to point a browser; empty for a socket with no --public-url. */
+  url: string;
+  /** The first LAN URL, for other devices; empty when loopback-only. */
+  shareUrl: string;
+}
+
+function listenTcp(
+  opts: Options,
+  tls: TLSOptions | undefined,
+  serving: Serving,
+  log: Logger,
+): Listening {
+  const attempts = opts.strictPort || opts.port === 0 ? 1 : PORT_ATTEMPTS;
+  let server: Server;
+  try {
+    server = listenWithFallback(opts.port, attempts, (port) =>
+      Bun.serve({
+        port,
+        hostname: opts.host,
+        ...(tls ? { tls } : {}),
+        ...serving,
+      }),
+    );
+  } catch (err) {
+    // Only the ports actually tried: other errors stop at the first.
+    const last = triedPort(err) ?? opts.port;
+    const ports =
+      last === opts.port ? opts.port : `${String(opts.port)}-${String(last)}`;
+    throw listenError(err, hostPort(opts.host, ports), last);
+  }
+
+  // With --port 0 the OS picks the port, so always read it back.
+  const port = server.port!;
+  const scheme = tls ? "https" : "http";
+  const url = formatUrl(scheme, browseHost(opts.host), port);
+  if (port !== opts.port && opts.port !== 0) {
+    log.info("Preferred port in use", { wanted: opts.port, port });
+  }
+  log.info(`Serving on ${url}`, { addr: opts.host, port });
+  if (!isLoopback(opts.host)) {
+    log.warn("Listening beyond loopback, reachable from your local network", {
+      addr: opts.host,
+    });
+  }
+  const lan = lanAddresses(opts.host, networkInterfaces()).map((addr) =>
+    formatUrl(scheme, addr, port),
+  );
+  for (const lanUrl of lan) {
+    log.info(`LAN: ${lanUrl}`, { port });
+  }
+  return { server, url, shareUrl: lan[0] ?? "" };
+}
+
+function listenUnix(
+  opts: Options,
+  tls: TLSOptions | undefined,
+  serving: Serving,
+  log: Logger,
+): Listening {
+  let server: Server;
+  try {
+    removeStaleSocket(opts.unix);
+    server = Bun.serve({
+      unix: opts.unix,
+      ...(tls ? { tls } : {}),
+      ...serving,
+    });
+  } catch (err) {
+    throw listenError(err, `unix:${opts.unix}`);
+  }
+  chmodSync(opts.unix, 0o600);
+  process.on("exit", () => {
+    rmSync(opts.unix, { force: true });
+  });
+  log.info(`Serving on unix:${opts.unix}`, { socket: opts.unix });
+  return { server, url: opts.publicUrl, shareUrl: "" };
+}
+
+/** Only TCP listeners beyond loopback are worth advertising. */
+function startMdns(
+  opts: Options,
+  server: Server,
+  log: Logger,
+): Advertisement | undefined {
+  if (opts.unix !== "" || isLoopback(opts.host)) {
+    log.warn("--mdns needs a non-loopback --host, not advertising", {
+      addr: opts.unix === "" ? opts.host : `unix:${opts.unix}`,
+    });
+    return undefined;
+  }
+  const addresses = lanAddresses(opts.host, networkInterfaces()).filter(
+    (addr) => isIPv4(addr),
+  );
+  if (addresses.length === 0) {
+    log.warn("No IPv4 LAN address to advertise over mDNS", {
+      addr: opts.host,
+    });
+    return undefined;
+  }
+  return advertise(server.port!, addresses, log);
+}
+
+function tlsOptions(opts: Options): TLSOptions | undefined {
+  if (opts.tlsCert !== "") {
+    return { cert: file(opts.tlsCert), key: file(opts.tlsKey) };
+  }
+  return opts.tlsSelfSigned ? selfSignedCert() : undefined;
+}
+
+/** Desktop entry point; `routes` maps request paths to embedded files. */
+export function main(routes: Record<string, string>): void {
+  let opts: Options;
+  try {
+    opts = parseOptions(process.argv.slice(2), process.env);
+  } catch (err) {
+    if (err instanceof UsageError) {
+      console.error(`brainbout: ${err.message}`);
+      process.exit(2);
+    }
+    throw err;
+  }
+  if (opts.version) {
+    console.log(versionString(BUILD));
+    return;
+  }
+
+  const log = createLogger({ level: opts.logLevel, format: opts.logFormat });
+  const missing = missingIndex(routes, opts.devDir);
+  if (missing !== "") {
+    log.error(missing);
+    process.exit(1);
+  }
+
+  // One instance per requested port: a second launch just reopens the
+  // first one in the browser. --port 0 and sockets always start afresh.
+  const locked =
+    opts.port === 0 || opts.unix !== ""
+      ? undefined
+      : acquireLock(lockPath(opts.port));
+  if (locked?.ok === false) {
+    const { pid, url } = locked.holder;
+    if (url === "") {
+      log.info("Another instance is still starting", { pid });
+    } else {
+      log.info(`Already running on ${url}`, { pid, url });
+      // The lock file is not proof of who wrote it; only open our own kind.
+      if (!isLocalUrl(url)) {
+        log.warn("Not opening a non-local URL from the lock file", { url });
+      } else if (!opts.noBrowser) {
+        browse(url, opts, log);
+      }
+    }
+    return;
+  }
+  const lock = locked?.lock;
+  process.on("exit", () => lock?.release());
+
+  const tls = tlsOptions(opts);
+  if (opts.authUser !== "" && tls === undefined) {
+    log.warn("Basic auth without TLS sends the password in the clear");
+  }
+  if (opts.unix !== "" && opts.rateLimit > 0) {
+    log.warn("--rate-limit behind --unix puts every client in one bucket");
+  }
+  if (opts.devDir !== "") {
+    log.warn("Dev mode: serving web assets from disk", { dir: opts.devDir });
+  }
+  if (opts.overlayDir !== "") {
+    log.info("Serving overrides from disk", { dir: opts.overlayDir });
+  }
+  const base = opts.devDir === "" ? assets(routes) : directory(opts.devDir);
+  const layered =
+    opts.overlayDir === "" ? base : overlay(opts.overlayDir, base);
+  const files = opts.devDir === "" ? layered : withLiveReload(layered);
+  const stats = statsHandler(() => ({
+    websockets: server.pendingWebSockets,
+    pendingRequests: server.pendingRequests,
+  }));
+  // Admin endpoints only exist once a token is configured; stats are
+  // public (behind any basic auth) until then.
+  const admin: Record<string, Handler> =
+    opts.adminToken === ""
+      ? {}
+      : {
+          "/api/shutdown": adminOnly(
+            opts.adminToken,
+            shutdownHandler(() => {
+              shutdown("api");
+            }),
+          ),
+          "/api/stats": adminOnly(opts.adminToken, stats, "GET"),
+        };
+  if (opts.noIsolation) {
+    log.warn(
+      "Cross-origin isolation is off: pages cannot use SharedArrayBuffer",
+    );
+  }
+  const headed = withHeaders(
+    files,
+    opts.noIsolation
+      ? HARDENING_HEADERS
+      : { ...ISOLATION_HEADERS, ...HARDENING_HEADERS },
+  );
+  // --csp "" turns the policy off for setups it gets in the way of.
+  const policed = (csp: string): Handler =>
+    csp === "" ? headed : withCsp(headed, csp);
+  // Swapped when SIGHUP reloads the config, like `shared` below.
+  let pages = policed(opts.csp);
+  const compressed = new Map<string, Uint8Array>();
+  // Embedded assets never change, so their tags and compressed output are
+  // worked out once per file, whichever path asked for it.
+  const assetKey =
+    opts.devDir === "" && opts.overlayDir === ""
+      ? (req: Request) => assetFor(routes, new URL(req.url).pathname)
+      : undefined;
+  const metrics = opts.metrics ? createMetrics() : undefined;
+  const scrape: Record<string, Handler> = metrics
+    ? {
+        "/metrics": metricsHandler(metrics, () => ({
+          websockets: {
+            help: "Open WebSocket connections.",
+            value: server.pendingWebSockets,
+          },
+          pending_requests: {
+            help: "Requests in flight.",
+            value: server.pendingRequests,
+          },
+        })),
+      }
+    : {};
+  // Known once listening; /qr is a 404 until then and when loopback-only.
+  let shareUrl = "";
+  // Health probes skip the page headers; those only matter for pages.
+  const app = mux(
+    {
+      "/version": version,
+      "/qr": qrCode(() => shareUrl),
+      ...scrape,
+      ...(opts.adminToken === "" ? { "/api/stats": stats } : {}),
+      // Behind basic auth and the rate limit like any other request.
+      ...(opts.devDir === "" ? {} : { [LIVERELOAD_PATH]: upgrade }),
+    },
+    withRanges(
+      withEtag(
+        withCompression((req) => pages(req), compressed, assetKey),
+        assetKey,
+      ),
+    ),
+  );
+  // Probes and the admin API (which has its own token) bypass basic auth;
+  // scrapers can send credentials, so /metrics stays behind it.
+  const routed = mux(
+    { "/healthz": healthz, ...admin },
+    opts.authUser === ""
+      ? app
+      : withBasicAuth(app, opts.authUser, opts.authPass),
+  );
+  // Outside basic auth: preflights never carry credentials.
+  const cors = (origins: readonly string[]): Handler =>
+    origins.length === 0 ? routed : withCors(routed, origins);
+  let shared = cors(opts.corsOrigins);
+  const current: Handler = (req) => shared(req);
+  const handler =
+    opts.rateLimit === 0
+      ? current
+      : withRateLimit(
+          current,
+          createRateLimiter(opts.rateLimit, opts.rateBurst),
+          (req) => server.requestIP(req)?.address ?? "",
+        );
+  const idle =
+    opts.idleTimeout > 0
+      ? createIdleTimer(opts.idleTimeout, () => {
+          log.info("No requests within the idle timeout", {
+            timeoutMs: opts.idleTimeout,
+          });
+          shutdown("idle-timeout");
+        })
+      : undefined;
+  const measured = metrics ? withMetrics(handler, metrics) : handler;
+  const logged = opts.accessLog ? withAccessLog(measured, log) : measured;
+  const fetch = idle ? withActivity(logged, idle) : logged;
+  const sockets = createSocketRegistry<ServerWebSocket<undefined>>();
+  const serving = createServing(fetch, {
+    connTimeout: opts.connTimeout,
+    wsTimeout: opts.wsTimeout,
+    sockets,
+    topic: LIVERELOAD_TOPIC,
+  });
+
+  let listening: Listening;
+  try {
+    listening =
+      opts.unix === ""
+        ? listenTcp(opts, tls, serving, log)
+        : listenUnix(opts, tls, serving, log);
+  } catch (err) {
+    log.error((err as Error).message);
+    process.exit(1);
+  }
+  const { server, url } = listening;
+  shareUrl = listening.shareUrl;
+  lock?.publish(url);
+  if (opts.addrFile !== "") {
+    try {
+      process.on(
+        "exit",
+        writeAddrFile(opts.addrFile, url || `unix:${opts.unix}`),
+      );
+    } catch (err) {
+      log.error(`cannot write --addr-file: ${(err as Error).message}`);
+      process.exit(1);
+    }
+  }
+  if (url !== "" && !opts.noBrowser) {
+    browse(url, opts, log);
+  }
+  const mdns = opts.mdns ? startMdns(opts, server, log) : undefined;
+  const unwatch =
+    opts.devDir === ""
+      ? undefined
+      : watchDir(opts.devDir, () => {
+          log.info("Assets changed, reloading pages", { dir: opts.devDir });
+          server.publish(LIVERELOAD_TOPIC, "reload");
+        });
+
+  // stop() lets in-flight requests finish; after --shutdown-timeout,
+  // stop(true) cuts whatever is left. Same path with or without TLS.
+  let stopping = false;
+  function shutdown(reason: string): void {
+    if (stopping) {
+      return;
+    }
+    stopping = true;
+    idle?.stop();
+    unwatch?.();
+    const pending = (): number =>
+      server.pendingRequests + server.pendingWebSockets;
+    log.info("Shutting down", { reason, pending: pending() });
+    const force = setTimeout(() => {
+      log.warn("Shutdown timeout reached, closing connections", {
+        timeoutMs: opts.shutdownTimeout,
+        pending: pending(),
+      });
+      void server.stop(true).then(() => process.exit(0));
+    }, opts.shutdownTimeout);
+    // Say goodbye first so LAN browsers drop us before the port closes,
+    // and so pages see a clean close instead of a dropped connection.
+    void (mdns?.stop() ?? Promise.resolve())
+      .then(() => sockets.closeAll("server shutting down", SOCKET_CLOSE_MS))
+      .then(() => server.stop())
+      .then(() => {
+        clearTimeout(force);
+        process.exit(0);
+      });
+  }
+  process.on("SIGINT", shutdown);
+  process.on("SIGTERM", shutdown);
+  // Re-read the config file and environment. Only LIVE_OPTIONS apply to
+  // a running server; the rest are baked into listeners and the handler
+  // chain, so changes to them are reported as needing a restart.
+  const reloadConfig = (): void => {
+    let next: Options;
+    try {
+      next = parseOptions(process.argv.slice(2), process.env);
+    } catch (err) {
+      if (!(err instanceof UsageError)) {
+        throw err;
+      }
+      log.error(`Config not reloaded: ${err.message}`);
+      return;
+    }
+    const changed = changedOptions(opts, next);
+    const live = changed.filter((key) => LIVE_OPTIONS.includes(key));
+    const fixed = changed.filter((key) => !LIVE_OPTIONS.includes(key));
+    log.setLevel(next.logLevel);
+    pages = policed(next.csp);
+    shared = cors(next.corsOrigins);
+    opts = {
+      ...opts,
+      logLevel: next.logLevel,
+      csp: next.csp,
+      corsOrigins: next.corsOrigins,
+    };
+    log.info("Reloaded config on SIGHUP", {
+      changed: live.length === 0 ? "none" : live.join(","),
+    });
+    if (fixed.length > 0) {
+      log.warn("Config changes that need a restart", {
+        options: fixed.join(","),
+      });
+    }
+  };
+  // SIGHUP reloads the config and drops in-memory caches instead of
+  // exiting. Dev-dir files are read live anyway; the compression cache
+  // keeps output for files that have since changed. Windows has no SIGHUP.
+  if (process.platform !== "win32") {
+    process.on("SIGHUP", () => {
+      const entries = compressed.size;
+      compressed.clear();
+      log.info("Dropped caches on SIGHUP", { compressedDropped: entries });
+      reloadConfig();
+    });
+  }
+}
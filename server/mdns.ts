@@ -0,0 +1,167 @@
+// Just enough multicast DNS (RFC 6762/6763) wire format to advertise one
+// service: encode our records, and read the questions in others' queries.
+
+export const GROUP = "224.0.0.251";
+export const MDNS_PORT = 5353;
+export const TTL = 120;
+
+export const SERVICE = "_brainbout._tcp.local";
+export const INSTANCE = `Brainbout.${SERVICE}`;
+export const HOST = "brainbout.local";
+
+export const TYPE = { A: 1, PTR: 12, TXT: 16, SRV: 33 } as const;
+
+export interface Question {
+  name: string;
+  type: number;
+}
+
+export interface ResourceRecord {
+  name: string;
+  type: number;
+  /** Sets the cache-flush bit: nobody else answers for this name. */
+  unique: boolean;
+  ttl: number;
+  data: number[];
+}
+
+function u16(n: number): number[] {
+  return [(n >> 8) & 0xff, n & 0xff];
+}
+
+function u32(n: number): number[] {
+  return [...u16(n >>> 16), ...u16(n & 0xffff)];
+}
+
+export function encodeName(name: string): number[] {
+  const out: number[] = [];
+  for (const label of name.split(".")) {
+    const bytes = new TextEncoder().encode(label);
+    out.push(bytes.length, ...bytes);
+  }
+  out.push(0);
+  return out;
+}
+
+function encodeRecord(r: ResourceRecord): number[] {
+  return [
+    ...encodeName(r.name),
+    ...u16(r.type),
+    ...u16(r.unique ? 0x8001 : 0x0001),
+    ...u32(r.ttl),
+    ...u16(r.data.length),
+    ...r.data,
+  ];
+}
+
+/** The record set advertising the server on `port` at `addresses`. */
+export function records(
+  port: number,
+  addresses: string[],
+  ttl = TTL,
+): ResourceRecord[] {
+  const txt = new TextEncoder().encode("path=/");
+  return [
+    {
+      name: SERVICE,
+      type: TYPE.PTR,
+      unique: false,
+      ttl,
+      data: encodeName(INSTANCE),
+    },
+    {
+      name: INSTANCE,
+      type: TYPE.SRV,
+      unique: true,
+      ttl,
+      data: [...u16(0), ...u16(0), ...u16(port), ...encodeName(HOST)],
+    },
+    {
+      name: INSTANCE,
+      type: TYPE.TXT,
+      unique: true,
+      ttl,
+      data: [txt.length, ...txt],
+    },
+    ...addresses.map((addr) => ({
+      name: HOST,
+      type: TYPE.A,
+      unique: true,
+      ttl,
+      data: addr.split(".").map(Number),
+    })),
+  ];
+}
+
+export function encodeResponse(answers: ResourceRecord[]): Uint8Array {
+  return Uint8Array.from([
+    ...u16(0),
+    ...u16(0x8400),
+    ...u16(0),
+    ...u16(answers.length),
+    ...u16(0),
+    ...u16(0),
+    ...answers.flatMap(encodeRecord),
+  ]);
+}
+
+function readName(buf: Uint8Array, offset: number): [string, number] {
+  const labels: string[] = [];
+  let at = offset;
+  let end = -1;
+  for (let jumps = 0; ; ) {
+    const len = buf[at];
+    if (len === undefined) {
+      throw new RangeError("truncated name");
+    }
+    if (len === 0) {
+      at++;
+      break;
+    }
+    if ((len & 0xc0) === 0xc0) {
+      if (++jumps > 16) {
+        throw new RangeError("compression loop");
+      }
+      if (end < 0) {
+        end = at + 2;
+      }
+      at = ((len & 0x3f) << 8) | (buf[at + 1] ?? 0);
+      continue;
+    }
+    labels.push(new TextDecoder().decode(buf.subarray(at + 1, at + 1 + len)));
+    at += 1 + len;
+  }
+  return [labels.join("."), end < 0 ? at : end];
+}
+
+/** The questions in an mDNS query; responses and junk yield none. */
+export function parseQuestions(buf: Uint8Array): Question[] {
+  if (buf.length < 12 || (buf[2]! & 0x80) !== 0) {
+    return [];
+  }
+  const count = (buf[4]! << 8) | buf[5]!;
+  const out: Question[] = [];
+  let at = 12;
+  try {
+    for (let i = 0; i < count; i++) {
+      const [name, next] = readName(buf, at);
+      if (next + 4 > buf.length) {
+        break;
+      }
+      out.push({
+        name: name.toLowerCase(),
+        type: (buf[next]! << 8) | buf[next + 1]!,
+      });
+      at = next + 4;
+    }
+  } catch {
+    // Keep whatever parsed cleanly before the damage.
+  }
+  return out;
+}
+
+const OURS = new Set([SERVICE, INSTANCE, HOST].map((n) => n.toLowerCase()));
+
+export function asksForUs(questions: Question[]): boolean {
+  return questions.some((q) => OURS.has(q.name));
+}
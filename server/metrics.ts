@@ -0,0 +1,91 @@
+import type { Handler } from "./handler";
+
+// Prometheus' default buckets, in seconds.
+const BUCKETS = [0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10];
+
+export interface Metrics {
+  observe: (status: number, seconds: number) => void;
+  /** The text exposition format, with `gauges` sampled at call time. */
+  render: (gauges: Record<string, Gauge>) => string;
+}
+
+export interface Gauge {
+  help: string;
+  value: number;
+}
+
+/** Request counters and a latency histogram, without a client library. */
+export function createMetrics(): Metrics {
+  const byClass = new Map<string, number>();
+  const counts = BUCKETS.map(() => 0);
+  let sum = 0;
+  let count = 0;
+  return {
+    observe: (status, seconds) => {
+      const cls = `${String(Math.floor(status / 100))}xx`;
+      byClass.set(cls, (byClass.get(cls) ?? 0) + 1);
+      for (const [i, le] of BUCKETS.entries()) {
+        if (seconds <= le) {
+          counts[i]!++;
+        }
+      }
+      sum += seconds;
+      count++;
+    },
+    render: (gauges) => {
+      const lines = [
+        "# HELP brainbout_requests_total Requests served, by status class.",
+        "# TYPE brainbout_requests_total counter",
+        ...[...byClass]
+          .sort(([a], [b]) => a.localeCompare(b))
+          .map(([cls, n]) => `brainbout_requests_total{code="${cls}"} ${n}`),
+        "# HELP brainbout_request_duration_seconds Time to response headers.",
+        "# TYPE brainbout_request_duration_seconds histogram",
+        ...BUCKETS.map(
+          (le, i) =>
+            `brainbout_request_duration_seconds_bucket{le="${le}"} ${counts[i]!}`,
+        ),
+        `brainbout_request_duration_seconds_bucket{le="+Inf"} ${count}`,
+        `brainbout_request_duration_seconds_sum ${sum}`,
+        `brainbout_request_duration_seconds_count ${count}`,
+      ];
+      for (const [name, g] of Object.entries(gauges)) {
+        lines.push(
+          `# HELP brainbout_${name} ${g.help}`,
+          `# TYPE brainbout_${name} gauge`,
+          `brainbout_${name} ${g.value}`,
+        );
+      }
+      return `${lines.join("\n")}\n`;
+    },
+  };
+}
+
+/** Count every request and its latency; a throwing handler counts as 500. */
+export function withMetrics(
+  next: Handler,
+  metrics: Metrics,
+  now: () => number = performance.now.bind(performance),
+): Handler {
+  return async (req) => {
+    const start = now();
+    let status = 500;
+    try {
+      const res = await next(req);
+      status = res.status;
+      return res;
+    } finally {
+      metrics.observe(status, (now() - start) / 1000);
+    }
+  };
+}
+
+export function metricsHandler(
+  metrics: Metrics,
+  gauges: () => Record<string, Gauge>,
+): Handler {
+  return () =>
+    new Response(metrics.render(gauges()), {
+      headers: { "Content-Type": "text/plain; version=0.0.4; charset=utf-8" },
+    });
+}
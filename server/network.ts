@@ -0,0 +1,158 @@
+import { lstatSync, rmSync } from "node:fs";
+import type { NetworkInterfaceInfo } from "node:os";
+
+export function isLoopback(host: string): boolean {
+  return host === "localhost" || host === "::1" || host.startsWith("127.");
+}
+
+/** Whether `url` is http(s) on this machine, e.g. one read from a file. */
+export function isLocalUrl(url: string): boolean {
+  let parsed: URL;
+  try {
+    parsed = new URL(url);
+  } catch {
+    return false;
+  }
+  const host = parsed.hostname.replace(/^\[(.*)\]$/u, "$1");
+  return /^https?:$/u.test(parsed.protocol) && isLoopback(host);
+}
+
+function isUnspecified(host: string): boolean {
+  return host === "0.0.0.0" || host === "::";
+}
+
+/** `host:port`, bracketing IPv6 hosts; `port` may be a range like 80-89. */
+export function hostPort(host: string, port: number | string): string {
+  const h = host.includes(":") ? `[${host}]` : host;
+  return `${h}:${String(port)}`;
+}
+
+export function formatUrl(scheme: string, host: string, port: number): string {
+  return `${scheme}://${hostPort(host, port)}`;
+}
+
+/**
+ * `path` (with any query) under `base`, percent-encoded where needed. A
+ * path in `base`, as a --public-url may have, is kept.
+ */
+export function pageUrl(base: string, path: string): string {
+  const dir = base.endsWith("/") ? base : `${base}/`;
+  return new URL(`.${path}`, dir).href;
+}
+
+/** The host a local browser should use to reach a server bound to `host`. */
+export function browseHost(host: string): string {
+  return isUnspecified(host) ? "127.0.0.1" : host;
+}
+
+/**
+ * Addresses other devices can use to reach a server bound to `host`: every
+ * external IPv4 interface for a wildcard bind, otherwise just `host`.
+ */
+export function lanAddresses(
+  host: string,
+  interfaces: NodeJS.Dict<NetworkInterfaceInfo[]>,
+): string[] {
+  if (isLoopback(host)) {
+    return [];
+  }
+  if (!isUnspecified(host)) {
+    return [host];
+  }
+  const out: string[] = [];
+  for (const infos of Object.values(interfaces)) {
+    for (const info of infos ?? []) {
+      if (!info.internal && info.family === "IPv4") {
+        out.push(info.address);
+      }
+    }
+  }
+  return out;
+}
+
+export const PORT_ATTEMPTS = 10;
+
+function code(err: unknown): unknown {
+  return (err as { code?: unknown } | null)?.code;
+}
+
+function inUse(err: unknown): boolean {
+  return code(err) === "EADDRINUSE";
+}
+
+// The port each error listenWithFallback rethrew came from.
+const failedPorts = new WeakMap<object, number>();
+
+/**
+ * Call `listen` on `port`, moving up one port at a time while the address is
+ * in use, for at most `attempts` ports. Other errors are rethrown at once;
+ * `triedPort` tells which port a rethrown error came from.
+ */
+export function listenWithFallback<T>(
+  port: number,
+  attempts: number,
+  listen: (port: number) => T,
+): T {
+  for (let i = 0; ; i++) {
+    try {
+      return listen(port + i);
+    } catch (err) {
+      if (!inUse(err) || i + 1 >= attempts || port + i >= 65_535) {
+        if (typeof err === "object" && err !== null) {
+          failedPorts.set(err, port + i);
+        }
+        throw err;
+      }
+    }
+  }
+}
+
+/** The last port listenWithFallback tried before giving up with `err`. */
+export function triedPort(err: unknown): number | undefined {
+  return typeof err === "object" && err !== null
+    ? failedPorts.get(err)
+    : undefined;
+}
+
+function listenReason(err: unknown, port: number): string {
+  switch (code(err)) {
+    case "EACCES":
+      return port > 0 && port < 1024
+        ? "permission denied; ports below 1024 need root or " +
+            "CAP_NET_BIND_SERVICE, so try a higher --port"
+        : "permission denied";
+    case "EADDRINUSE":
+      return "address in use; stop the other server or pick another --port";
+    case "EADDRNOTAVAIL":
+      return "no such address on this machine; check --host";
+    default:
+      return (err as Error).message;
+  }
+}
+
+/**
+ * Explain a failed listen on `where` (host:port or a socket path) in terms a
+ * new user can act on, keeping the original error as the cause.
+ */
+export function listenError(err: unknown, where: string, port = 0): Error {
+  return new Error(`cannot listen on ${where}: ${listenReason(err, port)}`, {
+    cause: err,
+  });
+}
+
+/**
+ * Clear a socket file left behind by an earlier run so it can be bound
+ * again. Refuses to delete anything that is not a socket.
+ */
+export function removeStaleSocket(path: string): void {
+  let isSocket: boolean;
+  try {
+    isSocket = lstatSync(path).isSocket();
+  } catch {
+    return;
+  }
+  if (!isSocket) {
+    throw new Error(`${path} exists and is not a socket`);
+  }
+  rmSync(path);
+}
@@ -0,0 +1,453 @@
+import { readFileSync } from "node:fs";
+import { join } from "node:path";
+import { type ParseArgsConfig, parseArgs } from "node:util";
+import { TOML } from "bun";
+import { isOrigin } from "./cors";
+import { DEFAULT_CSP } from "./csp";
+import { FORMATS, type Format, LEVELS, type Level } from "./log";
+
+export const DEFAULT_PORT = 8960;
+export const DEFAULT_HOST = "127.0.0.1";
+export const DEFAULT_SHUTDOWN_TIMEOUT = "5s";
+export const DEFAULT_RATE_LIMIT = 10;
+export const DEFAULT_RATE_BURST = 20;
+export const DEFAULT_CONN_TIMEOUT = "10s";
+export const DEFAULT_WS_TIMEOUT = "120s";
+
+// Bun's limits for its connection and WebSocket idle timeouts.
+const MAX_CONN_TIMEOUT = 255_000;
+const MAX_WS_TIMEOUT = 960_000;
+
+export interface Options {
+  port: number;
+  host: string;
+  noBrowser: boolean;
+  tlsCert: string;
+  tlsKey: string;
+  tlsSelfSigned: boolean;
+  strictPort: boolean;
+  logLevel: Level;
+  logFormat: Format;
+  version: boolean;
+  devDir: string;
+  idleTimeout: number;
+  shutdownTimeout: number;
+  unix: string;
+  publicUrl: string;
+  accessLog: boolean;
+  adminToken: string;
+  mdns: boolean;
+  csp: string;
+  authUser: string;
+  authPass: string;
+  rateLimit: number;
+  rateBurst: number;
+  metrics: boolean;
+  browser: string;
+  openPath: string;
+  corsOrigins: string[];
+  noIsolation: boolean;
+  addrFile: string;
+  overlayDir: string;
+  connTimeout: number;
+  wsTimeout: number;
+}
+
+/** What a running server picks up when SIGHUP re-reads the config. */
+export const LIVE_OPTIONS: readonly (keyof Options)[] = [
+  "logLevel",
+  "csp",
+  "corsOrigins",
+];
+
+/** The options whose values differ between `before` and `after`. */
+export function changedOptions(
+  before: Options,
+  after: Options,
+): (keyof Options)[] {
+  return (Object.keys(after) as (keyof Options)[]).filter(
+    (key) => JSON.stringify(before[key]) !== JSON.stringify(after[key]),
+  );
+}
+
+/** Thrown for bad command-line input; `main` prints it and exits 2. */
+export class UsageError extends Error {
+  override name = "UsageError";
+}
+
+export function parsePort(raw: string): number {
+  const port = Number(raw);
+  if (!/^\d+$/u.test(raw) || port > 65_535) {
+    throw new UsageError(
+      `invalid port "${raw}": want 1-65535, or 0 for any free port`,
+    );
+  }
+  return port;
+}
+
+const UNITS: Record<string, number> = {
+  ms: 1,
+  s: 1000,
+  m: 60_000,
+  h: 3_600_000,
+};
+
+/** Parse a Go-style duration such as "90s", "30m" or "1h30m" into ms. */
+export function parseDuration(flag: string, raw: string): number {
+  if (raw === "0") {
+    return 0;
+  }
+  const parts = [...raw.matchAll(/(\d+(?:\.\d+)?)(ms|s|m|h)/gu)];
+  if (parts.length === 0 || parts.map((p) => p[0]).join("") !== raw) {
+    throw new UsageError(
+      `invalid --${flag} "${raw}": want a duration like 90s, 30m or 1h30m`,
+    );
+  }
+  return parts.reduce((ms, p) => ms + Number(p[1]) * UNITS[p[2]!]!, 0);
+}
+
+/** A duration Bun takes in whole seconds, so at most `max` ms. */
+function timeout(flag: string, raw: string, max: number): number {
+  const ms = parseDuration(flag, raw);
+  if (ms > max) {
+    throw new UsageError(
+      `invalid --${flag} "${raw}": at most ${String(max / 1000)}s`,
+    );
+  }
+  return ms;
+}
+
+function nonNegative(
+  flag: string,
+  raw: string | undefined,
+  fallback: number,
+): number {
+  if (raw === undefined) {
+    return fallback;
+  }
+  const n = Number(raw);
+  if (raw.trim() === "" || !Number.isFinite(n) || n < 0) {
+    throw new UsageError(`invalid --${flag} "${raw}": want a number >= 0`);
+  }
+  return n;
+}
+
+function oneOf<T extends string>(
+  flag: string,
+  allowed: readonly T[],
+  raw: string | undefined,
+  fallback: T,
+): T {
+  if (raw === undefined) {
+    return fallback;
+  }
+  if (!(allowed as readonly string[]).includes(raw)) {
+    throw new UsageError(
+      `invalid --${flag} "${raw}": want one of ${allowed.join(", ")}`,
+    );
+  }
+  return raw as T;
+}
+
+/** Whether `raw` is an absolute http(s) URL. */
+function isWebUrl(raw: string): boolean {
+  try {
+    return /^https?:$/u.test(new URL(raw).protocol);
+  } catch {
+    return false;
+  }
+}
+
+const FLAGS = {
+  port: { type: "string", short: "p" },
+  host: { type: "string" },
+  "no-browser": { type: "boolean" },
+  "tls-cert": { type: "string" },
+  "tls-key": { type: "string" },
+  "tls-self-signed": { type: "boolean" },
+  "strict-port": { type: "boolean" },
+  "log-level": { type: "string" },
+  "log-format": { type: "string" },
+  quiet: { type: "boolean", short: "q" },
+  version: { type: "boolean" },
+  "dev-dir": { type: "string" },
+  "idle-timeout": { type: "string" },
+  "shutdown-timeout": { type: "string" },
+  unix: { type: "string" },
+  "public-url": { type: "string" },
+  "access-log": { type: "boolean" },
+  "admin-token": { type: "string" },
+  mdns: { type: "boolean" },
+  csp: { type: "string" },
+  "auth-user": { type: "string" },
+  "auth-pass": { type: "string" },
+  "rate-limit": { type: "string" },
+  "rate-burst": { type: "string" },
+  metrics: { type: "boolean" },
+  browser: { type: "string" },
+  "open-path": { type: "string" },
+  "cors-origin": { type: "string", multiple: true },
+  "no-isolation": { type: "boolean" },
+  "addr-file": { type: "string" },
+  "overlay-dir": { type: "string" },
+  "conn-timeout": { type: "string" },
+  "ws-timeout": { type: "string" },
+  config: { type: "string" },
+} as const satisfies ParseArgsConfig["options"];
+
+const SWITCHES = new Set(
+  Object.entries(FLAGS)
+    .filter(([, flag]) => flag.type === "boolean")
+    .map(([name]) => name),
+);
+
+function parseKnown(args: string[]) {
+  try {
+    return parseArgs({ args, options: FLAGS }).values;
+  } catch (err) {
+    throw new UsageError((err as Error).message);
+  }
+}
+
+function parseFlags(argv: string[]) {
+  // --no-mdns and friends undo a switch the config file turned on, and the
+  // last of --mdns and --no-mdns wins. This is done here because parseArgs'
+  // allowNegative would also take --no-browser for the negated --browser.
+  const last = new Map<string, boolean>();
+  const args = argv.filter((arg) => {
+    const name = arg.startsWith("--") ? arg.slice(2) : "";
+    if (SWITCHES.has(name)) {
+      last.set(name, true);
+      return true;
+    }
+    const negated = name.startsWith("no-") ? name.slice(3) : "";
+    if (SWITCHES.has(negated)) {
+      last.set(negated, false);
+      return false;
+    }
+    return true;
+  });
+  const values = parseKnown(args);
+  for (const [name, on] of last) {
+    (values as Record<string, boolean>)[name] = on;
+  }
+  return values;
+}
+
+/** Environment switches count as set unless "0" or "false"; empty is unset. */
+function envFlag(value: string | undefined): boolean | undefined {
+  return value === undefined || value === ""
+    ? undefined
+    : !["0", "false"].includes(value);
+}
+
+type FlagValues = ReturnType<typeof parseFlags>;
+
+// Meaningless in a file: one picks the file, the other exits at once.
+const CLI_ONLY = new Set(["config", "version"]);
+
+/**
+ * `$XDG_CONFIG_HOME/brainbout/config.toml`, falling back to ~/.config and
+ * then %APPDATA%; "" if none of them is set.
+ */
+export function defaultConfigPath(env: NodeJS.ProcessEnv): string {
+  const dir =
+    env.XDG_CONFIG_HOME ||
+    (env.HOME ? join(env.HOME, ".config") : "") ||
+    env.APPDATA ||
+    "";
+  return dir === "" ? "" : join(dir, "brainbout", "config.toml");
+}
+
+/**
+ * Parse a config file whose keys are flag names without the dashes, e.g.
+ * `port = 8961` or `no-browser = true`. JSON if the name ends in .json,
+ * TOML otherwise. Unknown keys are errors so typos don't go unnoticed.
+ */
+export function parseConfig(path: string, text: string): FlagValues {
+  const fail = (msg: string): UsageError =>
+    new UsageError(`config ${path}: ${msg}`);
+  let raw: unknown;
+  try {
+    raw = path.endsWith(".json") ? JSON.parse(text) : TOML.parse(text);
+  } catch (err) {
+    throw fail((err as Error).message);
+  }
+  if (typeof raw !== "object" || raw === null || Array.isArray(raw)) {
+    throw fail("want a table of flag names");
+  }
+  const out: Record<string, string | boolean | string[]> = {};
+  for (const [key, value] of Object.entries(raw)) {
+    if (!Object.hasOwn(FLAGS, key) || CLI_ONLY.has(key)) {
+      throw fail(`unknown key "${key}"`);
+    }
+    const flag: { type: string; multiple?: boolean } =
+      FLAGS[key as keyof typeof FLAGS];
+    const list = flag.multiple === true;
+    // A repeatable flag takes a list, or one value for a list of one.
+    const items: unknown[] = list && Array.isArray(value) ? value : [value];
+    const ok = items.every((v) =>
+      flag.type === "boolean"
+        ? typeof v === "boolean"
+        : typeof v === "string" || typeof v === "number",
+    );
+    if (!ok) {
+      throw fail(`"${key}" wants a ${flag.type}`);
+    }
+    const strings = items.map((v) =>
+      typeof v === "number" ? String(v) : (v as string | boolean),
+    );
+    out[key] = list ? (strings as string[]) : strings[0]!;
+  }
+  return out as FlagValues;
+}
+
+/** The --config file, or the default one if it exists. */
+function readConfig(cli: FlagValues, env: NodeJS.ProcessEnv): FlagValues {
+  const path = cli.config ?? defaultConfigPath(env);
+  if (path === "") {
+    return {};
+  }
+  let text: string;
+  try {
+    text = readFileSync(path, "utf-8");
+  } catch (err) {
+    // Only a default file may be missing; an explicit --config must exist.
+    const missing = (err as { code?: unknown }).code === "ENOENT";
+    if (missing && cli.config === undefined) {
+      return {};
+    }
+    throw new UsageError(`config ${path}: ${(err as Error).message}`);
+  }
+  return parseConfig(path, text);
+}
+
+/**
+ * Precedence, lowest first: built-in default, config file, environment,
+ * command line.
+ */
+export function parseOptions(
+  argv: string[],
+  env: NodeJS.ProcessEnv = {},
+): Options {
+  const cli = parseFlags(argv);
+  const file = readConfig(cli, env);
+  const values = { ...file, ...cli };
+  const tlsCert = values["tls-cert"] ?? "";
+  const tlsKey = values["tls-key"] ?? "";
+  if ((tlsCert === "") !== (tlsKey === "")) {
+    throw new UsageError("--tls-cert and --tls-key must be given together");
+  }
+  const authUser = values["auth-user"] ?? "";
+  const authPass =
+    cli["auth-pass"] ?? env.BRAINBOUT_AUTH_PASS ?? file["auth-pass"] ?? "";
+  if ((authUser === "") !== (authPass === "")) {
+    throw new UsageError("--auth-user and --auth-pass must be given together");
+  }
+  const cliAddr = cli.port !== undefined || cli.host !== undefined;
+  if (cli.unix !== undefined && cliAddr) {
+    throw new UsageError("--unix cannot be combined with --port or --host");
+  }
+  // Whichever of socket and address the command line names wins, so either
+  // can override the other from the config file.
+  const unix = cliAddr ? "" : (values.unix ?? "");
+  const port = unix === "" ? values.port : undefined;
+  const host = unix === "" ? values.host : undefined;
+  // A file's public URL goes with its socket, so only a flag's is an error.
+  const publicUrl = unix === "" ? cli["public-url"] : values["public-url"];
+  if (unix === "" && publicUrl !== undefined) {
+    throw new UsageError("--public-url only applies with --unix");
+  }
+  // It is opened, and published in the lock and --addr-file, as is.
+  if (publicUrl !== undefined && !isWebUrl(publicUrl)) {
+    throw new UsageError(
+      `invalid --public-url "${publicUrl}": want a URL like https://example.com`,
+    );
+  }
+  // Behind a socket every client has the proxy's (empty) address, so one
+  // bucket would throttle the whole site; limiting is then opt-in.
+  const rateLimit = nonNegative(
+    "rate-limit",
+    values["rate-limit"],
+    unix === "" ? DEFAULT_RATE_LIMIT : 0,
+  );
+  const rateBurst = nonNegative(
+    "rate-burst",
+    values["rate-burst"],
+    DEFAULT_RATE_BURST,
+  );
+  if (rateLimit > 0 && rateBurst < 1) {
+    throw new UsageError("--rate-burst must be at least 1");
+  }
+  const openPath = values["open-path"] ?? "/";
+  // Anything else could send the browser to another host.
+  if (!openPath.startsWith("/") || /^\/[/\\]/u.test(openPath)) {
+    throw new UsageError(
+      `invalid --open-path "${openPath}": want a path starting with one /`,
+    );
+  }
+  const corsOrigins = values["cors-origin"] ?? [];
+  for (const origin of corsOrigins) {
+    if (!isOrigin(origin)) {
+      throw new UsageError(
+        `invalid --cors-origin "${origin}": want an origin like https://example.com`,
+      );
+    }
+  }
+  const logLevel = oneOf("log-level", LEVELS, values["log-level"], "info");
+  // Errors still print: they are why the process exits.
+  const quiet = values.quiet === true;
+  return {
+    port: port === undefined ? DEFAULT_PORT : parsePort(port),
+    host: host || DEFAULT_HOST,
+    noBrowser:
+      cli["no-browser"] ??
+      envFlag(env.BRAINBOUT_NO_BROWSER) ??
+      file["no-browser"] ??
+      false,
+    tlsCert,
+    tlsKey,
+    tlsSelfSigned: values["tls-self-signed"] === true,
+    strictPort: values["strict-port"] === true,
+    logLevel: quiet ? "error" : logLevel,
+    logFormat: oneOf("log-format", FORMATS, values["log-format"], "text"),
+    version: values.version === true,
+    devDir: values["dev-dir"] ?? "",
+    idleTimeout: parseDuration("idle-timeout", values["idle-timeout"] ?? "0"),
+    shutdownTimeout: parseDuration(
+      "shutdown-timeout",
+      values["shutdown-timeout"] ?? DEFAULT_SHUTDOWN_TIMEOUT,
+    ),
+    unix,
+    publicUrl: publicUrl ?? "",
+    accessLog: values["access-log"] === true,
+    adminToken:
+      cli["admin-token"] ??
+      env.BRAINBOUT_ADMIN_TOKEN ??
+      file["admin-token"] ??
+      "",
+    mdns: values.mdns === true,
+    csp: values.csp ?? DEFAULT_CSP,
+    authUser,
+    authPass,
+    rateLimit,
+    rateBurst,
+    metrics: values.metrics === true,
+    browser: cli.browser ?? env.BRAINBOUT_BROWSER ?? file.browser ?? "",
+    openPath,
+    corsOrigins,
+    noIsolation: values["no-isolation"] === true,
+    addrFile: values["addr-file"] ?? "",
+    overlayDir: values["overlay-dir"] ?? "",
+    connTimeout: timeout(
+      "conn-timeout",
+      values["conn-timeout"] ?? DEFAULT_CONN_TIMEOUT,
+      MAX_CONN_TIMEOUT,
+    ),
+    wsTimeout: timeout(
+      "ws-timeout",
+      values["ws-timeout"] ?? DEFAULT_WS_TIMEOUT,
+      MAX_WS_TIMEOUT,
+    ),
+  };
+}
@@ -0,0 +1,394 @@
+// A QR code encoder (ISO/IEC 18004) for the one thing the server needs: a
+// short URL, in byte mode at error-correction level M, versions 1-10.
+
+import type { Handler } from "./handler";
+import { encodePng } from "./png";
+
+// Indexed by version; level M only.
+const ECC_PER_BLOCK = [0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26];
+const BLOCKS = [0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5];
+const MAX_VERSION = 10;
+
+export type Matrix = boolean[][];
+
+function gfMul(x: number, y: number): number {
+  let z = 0;
+  for (let i = 7; i >= 0; i--) {
+    z = (z << 1) ^ ((z >>> 7) * 0x11d);
+    z ^= ((y >>> i) & 1) * x;
+  }
+  return z;
+}
+
+/** Reed-Solomon error-correction codewords for one block. */
+export function eccCodewords(data: number[], degree: number): number[] {
+  const divisor = new Array<number>(degree).fill(0);
+  divisor[degree - 1] = 1;
+  let root = 1;
+  for (let i = 0; i < degree; i++) {
+    for (let j = 0; j < degree; j++) {
+      divisor[j] = gfMul(divisor[j]!, root) ^ (divisor[j + 1] ?? 0);
+    }
+    root = gfMul(root, 2);
+  }
+  const out = new Array<number>(degree).fill(0);
+  for (const b of data) {
+    const factor = b ^ out.shift()!;
+    out.push(0);
+    for (let i = 0; i < degree; i++) {
+      out[i]! ^= gfMul(divisor[i]!, factor);
+    }
+  }
+  return out;
+}
+
+function rawModules(version: number): number {
+  let n = (16 * version + 128) * version + 64;
+  if (version >= 2) {
+    const align = Math.floor(version / 7) + 2;
+    n -= (25 * align - 10) * align - 55;
+  }
+  return version >= 7 ? n - 36 : n;
+}
+
+function dataCapacity(version: number): number {
+  return (
+    Math.floor(rawModules(version) / 8) -
+    ECC_PER_BLOCK[version]! * BLOCKS[version]!
+  );
+}
+
+function alignmentPositions(version: number): number[] {
+  if (version === 1) {
+    return [];
+  }
+  const count = Math.floor(version / 7) + 2;
+  const step = Math.ceil((version * 4 + 4) / (count * 2 - 2)) * 2;
+  const out = [6];
+  for (let pos = version * 4 + 10; out.length < count; pos -= step) {
+    out.splice(1, 0, pos);
+  }
+  return out;
+}
+
+/** Mode, length, payload, terminator and padding, as data codewords. */
+function dataCodewords(bytes: Uint8Array, version: number): number[] {
+  const bits: number[] = [];
+  const put = (value: number, len: number): void => {
+    for (let i = len - 1; i >= 0; i--) {
+      bits.push((value >>> i) & 1);
+    }
+  };
+  const capacity = dataCapacity(version) * 8;
+  put(0b0100, 4);
+  put(bytes.length, version < 10 ? 8 : 16);
+  for (const b of bytes) {
+    put(b, 8);
+  }
+  put(0, Math.min(4, capacity - bits.length));
+  put(0, (8 - (bits.length % 8)) % 8);
+  for (let pad = 0xec; bits.length < capacity; pad ^= 0xec ^ 0x11) {
+    put(pad, 8);
+  }
+  const out: number[] = [];
+  for (let i = 0; i < bits.length; i += 8) {
+    out.push(bits.slice(i, i + 8).reduce((acc, bit) => (acc << 1) | bit, 0));
+  }
+  return out;
+}
+
+/** Split into blocks, append each block's ECC, then interleave. */
+function interleave(data: number[], version: number): number[] {
+  const count = BLOCKS[version]!;
+  const eccLen = ECC_PER_BLOCK[version]!;
+  const total = Math.floor(rawModules(version) / 8);
+  const short = count - (total % count);
+  const shortLen = Math.floor(total / count) - eccLen;
+  const blocks: number[][] = [];
+  for (let i = 0, at = 0; i < count; i++) {
+    const len = shortLen + (i < short ? 0 : 1);
+    const block = data.slice(at, at + len);
+    at += len;
+    blocks.push([...block, ...eccCodewords(block, eccLen)]);
+  }
+  const out: number[] = [];
+  for (let i = 0; i < shortLen + 1 + eccLen; i++) {
+    for (const [j, block] of blocks.entries()) {
+      // Short blocks have no codeword at the last data position.
+      const k = j < short && i >= shortLen ? i - 1 : i;
+      if (j >= short || i !== shortLen) {
+        out.push(block[k]!);
+      }
+    }
+  }
+  return out;
+}
+
+function bchBits(value: number, poly: number, degree: number): number {
+  let rem = value;
+  for (let i = 0; i < degree; i++) {
+    rem = (rem << 1) ^ ((rem >>> (degree - 1)) * poly);
+  }
+  return (value << degree) | rem;
+}
+
+/** The 15 format bits for level M with `mask`. */
+export function formatBits(mask: number): number {
+  return bchBits(mask, 0x537, 10) ^ 0x5412;
+}
+
+/** The 18 version bits, only drawn from version 7 up. */
+export function versionBits(version: number): number {
+  return bchBits(version, 0x1f25, 12);
+}
+
+const MASKS: ((x: number, y: number) => boolean)[] = [
+  (x, y) => (x + y) % 2 === 0,
+  (_, y) => y % 2 === 0,
+  (x) => x % 3 === 0,
+  (x, y) => (x + y) % 3 === 0,
+  (x, y) => (Math.floor(x / 3) + Math.floor(y / 2)) % 2 === 0,
+  (x, y) => ((x * y) % 2) + ((x * y) % 3) === 0,
+  (x, y) => (((x * y) % 2) + ((x * y) % 3)) % 2 === 0,
+  (x, y) => (((x + y) % 2) + ((x * y) % 3)) % 2 === 0,
+];
+
+class Grid {
+  readonly size: number;
+  readonly modules: Matrix;
+  readonly reserved: boolean[][];
+
+  constructor(size: number) {
+    this.size = size;
+    this.modules = Array.from({ length: size }, () =>
+      new Array<boolean>(size).fill(false),
+    );
+    this.reserved = Array.from({ length: size }, () =>
+      new Array<boolean>(size).fill(false),
+    );
+  }
+
+  fixed(x: number, y: number, dark: boolean): void {
+    if (x >= 0 && y >= 0 && x < this.size && y < this.size) {
+      this.modules[y]![x] = dark;
+      this.reserved[y]![x] = true;
+    }
+  }
+
+  /** A square of rings around (cx, cy), dark where `ring` says so. */
+  rings(
+    cx: number,
+    cy: number,
+    r: number,
+    ring: (d: number) => boolean,
+  ): void {
+    for (let dy = -r; dy <= r; dy++) {
+      for (let dx = -r; dx <= r; dx++) {
+        const d = Math.max(Math.abs(dx), Math.abs(dy));
+        this.fixed(cx + dx, cy + dy, ring(d));
+      }
+    }
+  }
+
+  format(mask: number): void {
+    const bits = formatBits(mask);
+    const bit = (i: number): boolean => ((bits >>> i) & 1) === 1;
+    const n = this.size;
+    for (let i = 0; i < 6; i++) {
+      this.fixed(8, i, bit(i));
+    }
+    this.fixed(8, 7, bit(6));
+    this.fixed(8, 8, bit(7));
+    this.fixed(7, 8, bit(8));
+    for (let i = 9; i < 15; i++) {
+      this.fixed(14 - i, 8, bit(i));
+    }
+    for (let i = 0; i < 8; i++) {
+      this.fixed(n - 1 - i, 8, bit(i));
+    }
+    for (let i = 8; i < 15; i++) {
+      this.fixed(8, n - 15 + i, bit(i));
+    }
+    this.fixed(8, n - 8, true);
+  }
+}
+
+function functionPatterns(grid: Grid, version: number): void {
+  const n = grid.size;
+  for (let i = 0; i < n; i++) {
+    grid.fixed(6, i, i % 2 === 0);
+    grid.fixed(i, 6, i % 2 === 0);
+  }
+  const finder = (d: number): boolean => d !== 2 && d !== 4;
+  grid.rings(3, 3, 4, finder);
+  grid.rings(n - 4, 3, 4, finder);
+  grid.rings(3, n - 4, 4, finder);
+  const align = alignmentPositions(version);
+  const last = align.length - 1;
+  for (const [i, x] of align.entries()) {
+    for (const [j, y] of align.entries()) {
+      // The finder patterns already occupy three corners.
+      const corner = (i === 0 || i === last) && (j === 0 || j === last);
+      if (!corner || (i === last && j === last)) {
+        grid.rings(x, y, 2, (d) => d !== 1);
+      }
+    }
+  }
+  // Reserve the format areas now; the real bits go in once a mask is chosen.
+  grid.format(0);
+  if (version >= 7) {
+    const bits = versionBits(version);
+    for (let i = 0; i < 18; i++) {
+      const dark = ((bits >>> i) & 1) === 1;
+      grid.fixed(n - 11 + (i % 3), Math.floor(i / 3), dark);
+      grid.fixed(Math.floor(i / 3), n - 11 + (i % 3), dark);
+    }
+  }
+}
+
+/** Lay codewords out in the two-column zigzag, skipping the timing column. */
+function place(grid: Grid, codewords: number[]): void {
+  const n = grid.size;
+  let i = 0;
+  for (let right = n - 1; right >= 1; right -= 2) {
+    if (right === 6) {
+      right = 5;
+    }
+    const upward = ((right + 1) & 2) === 0;
+    for (let v = 0; v < n; v++) {
+      for (let j = 0; j < 2; j++) {
+        const x = right - j;
+        const y = upward ? n - 1 - v : v;
+        if (!grid.reserved[y]![x]) {
+          const byte = codewords[i >>> 3] ?? 0;
+          grid.modules[y]![x] = ((byte >>> (7 - (i & 7))) & 1) === 1;
+          i++;
+        }
+      }
+    }
+  }
+}
+
+function applyMask(grid: Grid, mask: number): void {
+  const test = MASKS[mask]!;
+  for (let y = 0; y < grid.size; y++) {
+    for (let x = 0; x < grid.size; x++) {
+      if (!grid.reserved[y]![x] && test(x, y)) {
+        grid.modules[y]![x] = !grid.modules[y]![x];
+      }
+    }
+  }
+}
+
+/**
+ * Score a masked symbol with the run, block and balance rules. Every mask
+ * decodes; the score only steers away from patterns that confuse scanners.
+ */
+function penalty(m: Matrix): number {
+  const n = m.length;
+  let score = 0;
+  const runs = (at: (i: number) => boolean): void => {
+    let len = 1;
+    for (let i = 1; i <= n; i++) {
+      if (i < n && at(i) === at(i - 1)) {
+        len++;
+        continue;
+      }
+      if (len >= 5) {
+        score += len - 2;
+      }
+      len = 1;
+    }
+  };
+  let dark = 0;
+  for (let a = 0; a < n; a++) {
+    runs((i) => m[a]![i]!);
+    runs((i) => m[i]![a]!);
+    for (let b = 0; b < n; b++) {
+      const v = m[a]![b]!;
+      dark += v ? 1 : 0;
+      if (
+        a + 1 < n &&
+        b + 1 < n &&
+        v === m[a]![b + 1] &&
+        v === m[a + 1]![b] &&
+        v === m[a + 1]![b + 1]
+      ) {
+        score += 3;
+      }
+    }
+  }
+  return score + Math.floor(Math.abs((dark * 100) / (n * n) - 50) / 5) * 10;
+}
+
+/** Encode `text` as the smallest level-M symbol that fits it. */
+export function encodeQr(text: string): Matrix {
+  const bytes = new TextEncoder().encode(text);
+  let version = 1;
+  while (bytes.length + (version < 10 ? 2 : 3) > dataCapacity(version)) {
+    if (++version > MAX_VERSION) {
+      throw new RangeError(`too long for a QR code: ${bytes.length} bytes`);
+    }
+  }
+  const grid = new Grid(version * 4 + 17);
+  functionPatterns(grid, version);
+  place(grid, interleave(dataCodewords(bytes, version), version));
+  let best = 0;
+  let bestScore = Infinity;
+  for (let mask = 0; mask < MASKS.length; mask++) {
+    applyMask(grid, mask);
+    grid.format(mask);
+    const score = penalty(grid.modules);
+    if (score < bestScore) {
+      best = mask;
+      bestScore = score;
+    }
+    applyMask(grid, mask);
+  }
+  applyMask(grid, best);
+  grid.format(best);
+  return grid.modules;
+}
+
+// Four modules of quiet zone, as the spec requires, at 8 px per module.
+const QUIET = 4;
+const SCALE = 8;
+
+/** Render `m` as a black-on-white greyscale PNG. */
+export function qrPng(m: Matrix): Uint8Array {
+  const side = (m.length + QUIET * 2) * SCALE;
+  const rows: Uint8Array[] = [];
+  for (let y = 0; y < side; y++) {
+    const row = new Uint8Array(side).fill(0xff);
+    const my = Math.floor(y / SCALE) - QUIET;
+    for (let x = 0; x < side; x++) {
+      if (m[my]?.[Math.floor(x / SCALE) - QUIET] === true) {
+        row[x] = 0;
+      }
+    }
+    rows.push(row);
+  }
+  return encodePng(side, side, rows);
+}
+
+/**
+ * Serve a PNG QR code of `target()`, for phones to scan instead of typing
+ * the LAN URL. 404 while there is nothing shareable (loopback only).
+ */
+export function qrCode(target: () => string): Handler {
+  const cache = new Map<string, Uint8Array>();
+  return () => {
+    const url = target();
+    if (url === "") {
+      return new Response("Not found", { status: 404 });
+    }
+    let png = cache.get(url);
+    if (png === undefined) {
+      png = qrPng(encodeQr(url));
+      cache.set(url, png);
+    }
+    return new Response(png, {
+      headers: { "Content-Type": "image/png", "Cache-Control": "no-cache" },
+    });
+  };
+}
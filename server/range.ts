@@ -0,0 +1,83 @@
+import type { Handler } from "./handler";
+
+export interface ByteRange {
+  start: number;
+  /** Inclusive, as in Content-Range. */
+  end: number;
+}
+
+/**
+ * The bytes of a `size`-byte body that a Range header asks for. Null means
+ * serve the whole body: the header is malformed, uses another unit or asks
+ * for several ranges, none of which are worth supporting here.
+ */
+export function parseRange(
+  header: string,
+  size: number,
+): ByteRange | "unsatisfiable" | null {
+  const m = /^bytes=(\d*)-(\d*)$/u.exec(header.trim());
+  if (m === null || (m[1] === "" && m[2] === "")) {
+    return null;
+  }
+  if (m[1] === "") {
+    const suffix = Number(m[2]);
+    return suffix === 0 || size === 0
+      ? "unsatisfiable"
+      : { start: Math.max(0, size - suffix), end: size - 1 };
+  }
+  const start = Number(m[1]);
+  const last = m[2] === "" ? Infinity : Number(m[2]);
+  if (last < start) {
+    return null;
+  }
+  return start >= size
+    ? "unsatisfiable"
+    : { start, end: Math.min(last, size - 1) };
+}
+
+/**
+ * Answer single-range GETs of 200 responses with 206 Partial Content, so an
+ * interrupted download of a big asset can resume. It wraps the ETag layer:
+ * If-Range must name the current tag, or the whole body is sent.
+ */
+export function withRanges(next: Handler): Handler {
+  return async (req) => {
+    const res = await next(req);
+    if (
+      req.method !== "GET" ||
+      res.status !== 200 ||
+      res.headers.has("Content-Encoding")
+    ) {
+      return res;
+    }
+    const headers = new Headers(res.headers);
+    headers.set("Accept-Ranges", "bytes");
+    const range = req.headers.get("Range");
+    const ifRange = req.headers.get("If-Range");
+    // Only strong tags count; we send no Last-Modified to compare dates to.
+    const stale = ifRange !== null && ifRange !== res.headers.get("ETag");
+    if (range === null || stale) {
+      return new Response(res.body, { status: 200, headers });
+    }
+    const body = new Uint8Array(await res.arrayBuffer());
+    const span = parseRange(range, body.length);
+    if (span === null) {
+      return new Response(body, { status: 200, headers });
+    }
+    if (span === "unsatisfiable") {
+      headers.set("Content-Range", `bytes */${String(body.length)}`);
+      headers.delete("Content-Length");
+      return new Response(null, { status: 416, headers });
+    }
+    const { start, end } = span;
+    headers.set(
+      "Content-Range",
+      `bytes ${String(start)}-${String(end)}/${String(body.length)}`,
+    );
+    headers.set("Content-Length", String(end - start + 1));
+    return new Response(body.subarray(start, end + 1), {
+      status: 206,
+      headers,
+    });
+  };
+}
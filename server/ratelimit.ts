@@ -0,0 +1,76 @@
+import type { Handler } from "./handler";
+
+export interface RateLimiter {
+  /** Take a token for `key`: 0 if allowed, else seconds until one is free. */
+  take: (key: string) => number;
+  /** Buckets currently held, for tests and metrics. */
+  size: () => number;
+}
+
+interface Bucket {
+  tokens: number;
+  at: number;
+}
+
+// Full buckets are dropped on the next sweep; a fresh one is identical.
+const SWEEP_MS = 60_000;
+
+/**
+ * A token bucket per key: `burst` requests at once, refilled at `rate` per
+ * second. Sweeps ride along with requests, so there is no timer to stop.
+ */
+export function createRateLimiter(
+  rate: number,
+  burst: number,
+  now: () => number = Date.now,
+): RateLimiter {
+  const buckets = new Map<string, Bucket>();
+  let swept = now();
+  const refill = (b: Bucket, t: number): number =>
+    Math.min(burst, b.tokens + ((t - b.at) / 1000) * rate);
+  return {
+    take: (key) => {
+      const t = now();
+      if (t - swept >= SWEEP_MS) {
+        swept = t;
+        for (const [k, b] of buckets) {
+          if (refill(b, t) >= burst) {
+            buckets.delete(k);
+          }
+        }
+      }
+      const b = buckets.get(key) ?? { tokens: burst, at: t };
+      b.tokens = refill(b, t);
+      b.at = t;
+      buckets.set(key, b);
+      if (b.tokens >= 1) {
+        b.tokens -= 1;
+        return 0;
+      }
+      return Math.ceil((1 - b.tokens) / rate);
+    },
+    size: () => buckets.size,
+  };
+}
+
+/** Limit requests under `prefixes` per client; static assets stay free. */
+export function withRateLimit(
+  next: Handler,
+  limiter: RateLimiter,
+  clientIp: (req: Request) => string,
+  prefixes = ["/api/", "/ws/"],
+): Handler {
+  return (req) => {
+    const { pathname } = new URL(req.url);
+    if (!prefixes.some((p) => pathname.startsWith(p))) {
+      return next(req);
+    }
+    const wait = limiter.take(clientIp(req));
+    return wait === 0
+      ? next(req)
+      : new Response("Too many requests", {
+          status: 429,
+          headers: { "Retry-After": String(wait) },
+        });
+  };
+}
@@ -0,0 +1,75 @@
+import type { ServerWebSocket, WebSocketHandler } from "bun";
+import type { Handler } from "./handler";
+import type { SocketRegistry } from "./sockets";
+
+// Marks responses that approve an upgrade. createServing answers those
+// itself, so the marker never reaches a client.
+const UPGRADE_HEADER = "X-Brainbout-Upgrade";
+
+/**
+ * Approve a WebSocket handshake. The upgrade itself needs Bun's server, so
+ * this only marks the response; createServing performs it once the rest of
+ * the chain (auth, rate limit, logging) has let the request through.
+ */
+export const upgrade: Handler = (req) =>
+  req.headers.get("Upgrade")?.toLowerCase() === "websocket"
+    ? new Response(null, { status: 200, headers: { [UPGRADE_HEADER]: "1" } })
+    : new Response("Expected a WebSocket", { status: 426 });
+
+/** The part of Bun's server that createServing needs. */
+export interface Upgrader {
+  upgrade: (req: Request) => boolean;
+}
+
+/** What Bun.serve gets: the app and timeouts, plus dev mode live reload. */
+export interface Serving {
+  idleTimeout: number;
+  fetch: (req: Request, server: Upgrader) => Promise<Response | undefined>;
+  websocket: WebSocketHandler<undefined>;
+}
+
+export interface ServingOptions {
+  /** Milliseconds a client may stall mid-request, headers included. */
+  connTimeout: number;
+  /** Milliseconds a WebSocket may go without answering a ping. */
+  wsTimeout: number;
+  sockets: SocketRegistry<ServerWebSocket<undefined>>;
+  /** What every WebSocket subscribes to. */
+  topic: string;
+}
+
+/** Bun's timeouts are whole seconds, with 0 turning them off. */
+function seconds(ms: number): number {
+  return Math.ceil(ms / 1000);
+}
+
+/** Serve `handler`, upgrading the requests it approves with `upgrade`. */
+export function createServing(
+  handler: Handler,
+  opts: ServingOptions,
+): Serving {
+  return {
+    idleTimeout: seconds(opts.connTimeout),
+    fetch: async (req, server) => {
+      const res = await handler(req);
+      if (!res.headers.has(UPGRADE_HEADER)) {
+        return res;
+      }
+      return server.upgrade(req)
+        ? undefined
+        : new Response("Expected a WebSocket", { status: 426 });
+    },
+    websocket: {
+      // Bun pings idle sockets, so only a dead peer hits this.
+      idleTimeout: seconds(opts.wsTimeout),
+      open: (ws) => {
+        opts.sockets.add(ws);
+        ws.subscribe(opts.topic);
+      },
+      message: () => {},
+      close: (ws) => {
+        opts.sockets.delete(ws);
+      },
+    },
+  };
+}
@@ -0,0 +1,58 @@
+/** WebSocket close code for a server going away (RFC 6455 §7.4.1). */
+export const GOING_AWAY = 1001;
+
+export interface Closable {
+  close: (code?: number, reason?: string) => void;
+}
+
+export interface SocketRegistry<T extends Closable> {
+  add: (ws: T) => void;
+  delete: (ws: T) => void;
+  size: () => number;
+  /**
+   * Send every open socket a going-away close frame and wait for them to
+   * go, at most `timeoutMs`. Resolves with how many were still open.
+   */
+  closeAll: (reason: string, timeoutMs: number) => Promise<number>;
+}
+
+/** The open sockets, so shutdown can say goodbye instead of dropping them. */
+export function createSocketRegistry<
+  T extends Closable,
+>(): SocketRegistry<T> {
+  const open = new Set<T>();
+  let drained: (() => void) | undefined;
+  return {
+    add: (ws) => {
+      open.add(ws);
+    },
+    delete: (ws) => {
+      open.delete(ws);
+      if (open.size === 0) {
+        drained?.();
+      }
+    },
+    size: () => open.size,
+    closeAll: (reason, timeoutMs) => {
+      if (open.size === 0) {
+        return Promise.resolve(0);
+      }
+      const done = new Promise<number>((resolve) => {
+        const timer = setTimeout(() => {
+          drained = undefined;
+          resolve(open.size);
+        }, timeoutMs);
+        drained = () => {
+          clearTimeout(timer);
+          drained = undefined;
+          resolve(0);
+        };
+      });
+      // Copied: a socket may report closing from inside close().
+      for (const ws of [...open]) {
+        ws.close(GOING_AWAY, reason);
+      }
+      return done;
+    },
+  };
+}
@@ -0,0 +1,108 @@
+import { generateKeyPairSync, randomBytes, sign } from "node:crypto";
+
+// Just enough DER to assemble one X.509 certificate.
+
+function der(tag: number, body: Uint8Array): Uint8Array {
+  const n = body.length;
+  const len =
+    n < 0x80
+      ? [n]
+      : n < 0x100
+        ? [0x81, n]
+        : [0x82, n >> 8, n & 0xff];
+  return new Uint8Array([tag, ...len, ...body]);
+}
+
+function seq(...items: Uint8Array[]): Uint8Array {
+  return der(0x30, concat(items));
+}
+
+function concat(items: Uint8Array[]): Uint8Array {
+  const out = new Uint8Array(items.reduce((sum, b) => sum + b.length, 0));
+  let at = 0;
+  for (const b of items) {
+    out.set(b, at);
+    at += b.length;
+  }
+  return out;
+}
+
+function oid(dotted: string): Uint8Array {
+  const [a, b, ...rest] = dotted.split(".").map(Number);
+  const bytes = [a! * 40 + b!];
+  for (const part of rest) {
+    const chunk = [part & 0x7f];
+    for (let v = part >> 7; v > 0; v >>= 7) {
+      chunk.unshift((v & 0x7f) | 0x80);
+    }
+    bytes.push(...chunk);
+  }
+  return der(0x06, new Uint8Array(bytes));
+}
+
+function utf8(s: string): Uint8Array {
+  return der(0x0c, new TextEncoder().encode(s));
+}
+
+function utcTime(d: Date): Uint8Array {
+  const s = d.toISOString().replace(/[-:T]/gu, "").slice(2, 14);
+  return der(0x17, new TextEncoder().encode(`${s}Z`));
+}
+
+function pem(label: string, body: Uint8Array): string {
+  const b64 = Buffer.from(body).toString("base64");
+  const lines = b64.match(/.{1,64}/gu) ?? [];
+  return `-----BEGIN ${label}-----\n${lines.join("\n")}\n-----END ${label}-----\n`;
+}
+
+const ECDSA_SHA256 = "1.2.840.10045.4.3.2";
+const COMMON_NAME = "2.5.4.3";
+const SUBJECT_ALT_NAME = "2.5.29.17";
+const VALID_DAYS = 365;
+
+export interface Certificate {
+  cert: string;
+  key: string;
+}
+
+/**
+ * Generate a throwaway self-signed P-256 certificate for localhost and
+ * 127.0.0.1. Nothing touches disk; browsers will still warn once.
+ */
+export function selfSignedCert(now = new Date()): Certificate {
+  const { publicKey, privateKey } = generateKeyPairSync("ec", {
+    namedCurve: "prime256v1",
+  });
+
+  const serial = randomBytes(16);
+  // Positive and with a non-zero first byte, so the INTEGER is minimal DER.
+  serial[0] = (serial[0]! & 0x7f) | 0x40;
+  const name = seq(der(0x31, seq(oid(COMMON_NAME), utf8("localhost"))));
+  const notAfter = new Date(now.getTime() + VALID_DAYS * 86_400_000);
+  const altNames = seq(
+    der(0x82, new TextEncoder().encode("localhost")),
+    der(0x87, new Uint8Array([127, 0, 0, 1])),
+  );
+
+  const tbs = seq(
+    der(0xa0, der(0x02, new Uint8Array([2]))),
+    der(0x02, serial),
+    seq(oid(ECDSA_SHA256)),
+    name,
+    seq(utcTime(now), utcTime(notAfter)),
+    name,
+    publicKey.export({ type: "spki", format: "der" }),
+    der(0xa3, seq(seq(oid(SUBJECT_ALT_NAME), der(0x04, altNames)))),
+  );
+  const signature = sign("sha256", tbs, privateKey);
+  const cert = seq(
+    tbs,
+    seq(oid(ECDSA_SHA256)),
+    der(0x03, concat([new Uint8Array([0]), signature])),
+  );
+
+  return {
+    cert: pem("CERTIFICATE", cert),
+    key: privateKey.export({ type: "pkcs8", format: "pem" }).toString(),
+  };
+}
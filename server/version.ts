@@ -0,0 +1,22 @@
+declare const __BB_VERSION__: string | undefined;
+declare const __BB_COMMIT__: string | undefined;
+declare const __BB_BUILD_DATE__: string | undefined;
+
+export interface BuildInfo {
+  version: string;
+  commit: string;
+  buildDate: string;
+}
+
+// server/build.ts defines these for compiled binaries; running from source
+// leaves them undefined.
+export const BUILD: BuildInfo = {
+  version: typeof __BB_VERSION__ === "string" ? __BB_VERSION__ : "dev",
+  commit: typeof __BB_COMMIT__ === "string" ? __BB_COMMIT__ : "unknown",
+  buildDate: typeof __BB_BUILD_DATE__ === "string" ? __BB_BUILD_DATE__ : "",
+};
+
+export function versionString(info: BuildInfo): string {
+  const built = info.buildDate === "" ? "" : `, built ${info.buildDate}`;
+  return `brainbout ${info.version} (commit ${info.commit}${built})`;
+}
@@ -0,0 +1,15 @@
+import { afterAll, beforeAll } from "bun:test";
+import { GlobalRegistrator } from "@happy-dom/global-registrator";
+
+/**
+ * Swap happy-dom's Request/Response/fetch back out for Bun's own while the
+ * calling test file runs; server code is written against the real ones.
+ */
+export function useNativeGlobals(): void {
+  beforeAll(() => {
+    GlobalRegistrator.unregister();
+  });
+  afterAll(() => {
+    GlobalRegistrator.register();
+  });
+}
@@ -0,0 +1,62 @@
+import { describe, expect, it } from "bun:test";
+import { withAccessLog } from "../server/access-log";
+import { createLogger } from "../server/log";
+import { useNativeGlobals } from "./native-globals";
+
+useNativeGlobals();
+
+function capture() {
+  const lines: string[] = [];
+  const log = createLogger({
+    level: "info",
+    format: "text",
+    write: (line) => {
+      lines.push(line);
+    },
+  });
+  return { lines, log };
+}
+
+function ticks(...values: number[]): () => number {
+  return () => values.shift() ?? 0;
+}
+
+describe("withAccessLog", () => {
+  it("logs the request once the body has been sent", async () => {
+    const { lines, log } = capture();
+    const handler = withAccessLog(
+      () => new Response("hello", { status: 201 }),
+      log,
+      ticks(100, 112.34),
+    );
+
+    const res = await handler(new Request("http://127.0.0.1:8960/api?x=1"));
+    expect(lines).toEqual([]);
+    expect(await res.text()).toBe("hello");
+    expect(res.status).toBe(201);
+    expect(lines).toEqual(["GET /api status=201 bytes=5 ms=12.3"]);
+  });
+
+  it("logs bodiless responses straight away", async () => {
+    const { lines, log } = capture();
+    const handler = withAccessLog(
+      () => new Response(null, { status: 304 }),
+      log,
+      ticks(0, 1),
+    );
+
+    await handler(new Request("http://127.0.0.1:8960/", { method: "HEAD" }));
+    expect(lines).toEqual(["HEAD / status=304 bytes=0 ms=1"]);
+  });
+
+  it("keeps the response headers", async () => {
+    const { log } = capture();
+    const handler = withAccessLog(
+      () => new Response("x", { headers: { "X-Test": "1" } }),
+      log,
+    );
+
+    const res = await handler(new Request("http://127.0.0.1:8960/"));
+    expect(res.headers.get("X-Test")).toBe("1");
+  });
+});
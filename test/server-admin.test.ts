@@ -0,0 +1,153 @@
+import { afterEach, beforeEach, describe, expect, it, jest } from "bun:test";
+import process from "node:process";
+import {
+  adminOnly,
+  authorized,
+  basicAuthorized,
+  shutdownHandler,
+  statsHandler,
+  withBasicAuth,
+} from "../server/admin";
+import { useNativeGlobals } from "./native-globals";
+
+useNativeGlobals();
+
+function post(headers: Record<string, string> = {}): Request {
+  return new Request("http://127.0.0.1:8960/api/shutdown", {
+    method: "POST",
+    headers,
+  });
+}
+
+describe("authorized", () => {
+  it("accepts the matching bearer token", () => {
+    expect(authorized("Bearer s3cret", "s3cret")).toBe(true);
+  });
+
+  it("rejects a missing, malformed or wrong token", () => {
+    expect(authorized(null, "s3cret")).toBe(false);
+    expect(authorized("s3cret", "s3cret")).toBe(false);
+    expect(authorized("Basic s3cret", "s3cret")).toBe(false);
+    expect(authorized("Bearer s3cre", "s3cret")).toBe(false);
+    expect(authorized("Bearer s3cret-and-more", "s3cret")).toBe(false);
+  });
+});
+
+function basic(credentials: string): string {
+  return `Basic ${btoa(credentials)}`;
+}
+
+describe("basicAuthorized", () => {
+  it("accepts the matching user and password", () => {
+    expect(
+      basicAuthorized(basic("kim:pw:with:colons"), "kim", "pw:with:colons"),
+    ).toBe(true);
+  });
+
+  it("rejects a missing, malformed or wrong credential", () => {
+    expect(basicAuthorized(null, "kim", "pw")).toBe(false);
+    expect(basicAuthorized("Bearer pw", "kim", "pw")).toBe(false);
+    expect(basicAuthorized("Basic !!!", "kim", "pw")).toBe(false);
+    expect(basicAuthorized(basic("kim:nope"), "kim", "pw")).toBe(false);
+    expect(basicAuthorized(basic("eve:pw"), "kim", "pw")).toBe(false);
+  });
+});
+
+describe("withBasicAuth", () => {
+  const handler = withBasicAuth(() => new Response("page"), "kim", "pw");
+
+  it("challenges requests without credentials", async () => {
+    const res = await handler(new Request("http://127.0.0.1:8960/"));
+    expect(res.status).toBe(401);
+    expect(res.headers.get("WWW-Authenticate")).toBe(
+      'Basic realm="brainbout", charset="UTF-8"',
+    );
+  });
+
+  it("passes authorized requests through", async () => {
+    const res = await handler(
+      new Request("http://127.0.0.1:8960/", {
+        headers: { Authorization: basic("kim:pw") },
+      }),
+    );
+    expect(await res.text()).toBe("page");
+  });
+});
+
+describe("adminOnly", () => {
+  const handler = adminOnly("s3cret", () => new Response("done"));
+
+  it("runs the handler for an authorized POST", async () => {
+    const res = await handler(post({ Authorization: "Bearer s3cret" }));
+    expect(res.status).toBe(200);
+    expect(await res.text()).toBe("done");
+  });
+
+  it("answers 401 without the right token", async () => {
+    for (const headers of [{}, { Authorization: "Bearer nope" }]) {
+      const res = await handler(post(headers));
+      expect(res.status).toBe(401);
+      expect(res.headers.get("WWW-Authenticate")).toBe("Bearer");
+    }
+  });
+
+  it("answers 405 to anything but POST", async () => {
+    const res = await handler(
+      new Request("http://127.0.0.1:8960/api/shutdown", {
+        headers: { Authorization: "Bearer s3cret" },
+      }),
+    );
+    expect(res.status).toBe(405);
+    expect(res.headers.get("Allow")).toBe("POST");
+  });
+
+  it("can guard another method", async () => {
+    const get = adminOnly("s3cret", () => new Response("stats"), "GET");
+    const res = await get(
+      new Request("http://127.0.0.1:8960/api/stats", {
+        headers: { Authorization: "Bearer s3cret" },
+      }),
+    );
+    expect(await res.text()).toBe("stats");
+    expect((await get(post())).headers.get("Allow")).toBe("GET");
+  });
+});
+
+describe("shutdownHandler", () => {
+  beforeEach(() => {
+    jest.useFakeTimers();
+  });
+
+  afterEach(() => {
+    jest.useRealTimers();
+  });
+
+  it("responds before shutting down", async () => {
+    const shutdown = jest.fn<() => void>();
+    const res = await shutdownHandler(shutdown)(post());
+    expect(res.status).toBe(200);
+    expect(shutdown).not.toHaveBeenCalled();
+    jest.advanceTimersByTime(0);
+    expect(shutdown).toHaveBeenCalledTimes(1);
+  });
+});
+
+describe("statsHandler", () => {
+  it("reports uptime, memory and connections", async () => {
+    const handler = statsHandler(
+      () => ({ websockets: 2, pendingRequests: 1 }),
+      1000,
+      () => 62_500,
+    );
+    const res = await handler(post());
+    const stats = (await res.json()) as Record<string, unknown>;
+    expect(stats).toMatchObject({
+      uptimeSeconds: 61,
+      pid: process.pid,
+      websockets: 2,
+      pendingRequests: 1,
+    });
+    expect(stats.runtime).toStartWith("bun ");
+    expect((stats.memory as { rssBytes: number }).rssBytes).toBeGreaterThan(0);
+  });
+});
@@ -0,0 +1,157 @@
+import { describe, expect, it } from "bun:test";
+import { delimiter } from "node:path";
+import process from "node:process";
+import {
+  browserCommands,
+  cmdEscape,
+  commandFor,
+  hyperlink,
+  openBrowser,
+  spawnDetached,
+  splitCommand,
+  urlBanner,
+} from "../server/browser";
+import { pageUrl } from "../server/network";
+import { parseOptions } from "../server/options";
+
+const PAGE_URL = "http://127.0.0.1:8960/";
+
+describe("splitCommand", () => {
+  it("splits on whitespace and keeps quoted arguments whole", () => {
+    expect(
+      splitCommand(`chrome  --profile-directory="Profile 2" 'a b'`),
+    ).toEqual(["chrome", "--profile-directory=Profile 2", "a b"]);
+    expect(splitCommand("  ")).toEqual([]);
+  });
+});
+
+describe("commandFor", () => {
+  it("substitutes %s or appends the URL", () => {
+    expect(commandFor("chrome --app=%s", PAGE_URL)).toEqual([
+      "chrome",
+      `--app=${PAGE_URL}`,
+    ]);
+    expect(commandFor("firefox -P games", PAGE_URL)).toEqual([
+      "firefox",
+      "-P",
+      "games",
+      PAGE_URL,
+    ]);
+  });
+
+  it("never lets the URL reach a shell", () => {
+    const url = "http://x/;rm -rf ~";
+    expect(commandFor("open", url)).toEqual(["open", url]);
+  });
+});
+
+describe("browserCommands", () => {
+  it("tries only a custom command", () => {
+    const env = { BROWSER: "firefox" };
+    const custom = '"/opt/My Chrome/chrome" %s';
+    expect(browserCommands(PAGE_URL, custom, "linux", env)).toEqual([
+      ["/opt/My Chrome/chrome", PAGE_URL],
+    ]);
+  });
+
+  it("escapes the URL for cmd.exe, and only there", () => {
+    const url = "http://127.0.0.1:8960/games/lex.html?a=1&b=(2)";
+    const [start, rundll] = browserCommands(url, "", "win32", {});
+    expect(start).toEqual([
+      "cmd",
+      "/c",
+      "start",
+      "",
+      "http://127.0.0.1:8960/games/lex.html?a=1^&b=^(2^)",
+    ]);
+    expect(rundll).toEqual(["rundll32", "url.dll,FileProtocolHandler", url]);
+  });
+
+  it("hands cmd.exe an --open-path query that survives its parsing", () => {
+    const { openPath } = parseOptions([
+      "--open-path",
+      "/games/lex.html?a=1&b=2|3",
+    ]);
+    const url = pageUrl(PAGE_URL, openPath);
+    expect(url).toBe("http://127.0.0.1:8960/games/lex.html?a=1&b=2|3");
+    const [start] = browserCommands(url, "", "win32", {});
+    // cmd.exe drops each caret and keeps the character after it.
+    expect(start?.at(-1)?.replace(/\^(.)/gu, "$1")).toBe(url);
+  });
+
+  it("uses the platform openers", () => {
+    expect(browserCommands(PAGE_URL, "", "darwin", {})).toEqual([["open", PAGE_URL]]);
+    expect(browserCommands(PAGE_URL, "", "win32", {})[0]).toEqual([
+      "cmd",
+      "/c",
+      "start",
+      "",
+      PAGE_URL,
+    ]);
+    expect(browserCommands(PAGE_URL, "", "linux", {}).map((c) => c[0])).toEqual([
+      "xdg-open",
+      "gio",
+      "sensible-browser",
+    ]);
+  });
+
+  it("puts every $BROWSER entry first", () => {
+    const env = { BROWSER: ["firefox", "", "chromium %s"].join(delimiter) };
+    expect(browserCommands(PAGE_URL, "", "darwin", env)).toEqual([
+      ["firefox", PAGE_URL],
+      ["chromium", PAGE_URL],
+      ["open", PAGE_URL],
+    ]);
+  });
+});
+
+describe("spawnDetached", () => {
+  it("reports whether the command started", async () => {
+    expect(await spawnDetached([process.execPath, "-e", ""])).toBe(true);
+    expect(await spawnDetached(["brainbout-no-such-command"])).toBe(false);
+  });
+});
+
+describe("cmdEscape", () => {
+  it("carets every metacharacter", () => {
+    expect(cmdEscape("a&b|c<d>e^f(g)")).toBe("a^&b^|c^<d^>e^^f^(g^)");
+    expect(cmdEscape(PAGE_URL)).toBe(PAGE_URL);
+  });
+});
+
+describe("openBrowser", () => {
+  it("stops at the first command that starts", async () => {
+    const tried: string[] = [];
+    const start = (cmd: string[]): Promise<boolean> => {
+      tried.push(cmd[0]!);
+      return Promise.resolve(cmd[0] === "b");
+    };
+    expect(await openBrowser([["a"], ["b"], ["c"]], start)).toEqual(["b"]);
+    expect(tried).toEqual(["a", "b"]);
+  });
+
+  it("rejects, naming the attempts, when none starts", async () => {
+    await expect(
+      openBrowser([["a"], ["b"]], () => Promise.resolve(false)),
+    ).rejects.toThrow("tried a, b");
+  });
+});
+
+describe("urlBanner", () => {
+  it("boxes the URL", () => {
+    expect(urlBanner(PAGE_URL, false).split("\n")).toEqual([
+      "+-------------------------------+",
+      "|  Open http://127.0.0.1:8960/  |",
+      "+-------------------------------+",
+    ]);
+  });
+
+  it("links it with OSC 8, keeping the box the same width", () => {
+    const [top, middle] = urlBanner(PAGE_URL, true).split("\n");
+    expect(middle).toBe(`|  Open ${hyperlink(PAGE_URL)}  |`);
+    expect(top).toBe(urlBanner(PAGE_URL, false).split("\n")[0]);
+    expect(hyperlink(PAGE_URL)).toBe(
+      `\u001b]8;;${PAGE_URL}\u001b\\${PAGE_URL}\u001b]8;;\u001b\\`,
+    );
+  });
+});
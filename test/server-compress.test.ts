@@ -0,0 +1,147 @@
+import { describe, expect, it } from "bun:test";
+import { brotliDecompressSync, gunzipSync } from "node:zlib";
+import { negotiate, withCompression } from "../server/compress";
+import { useNativeGlobals } from "./native-globals";
+
+useNativeGlobals();
+
+const BIG = "brainbout ".repeat(500);
+
+function serve(body: string, headers: Record<string, string>, status = 200) {
+  return { handler: () => new Response(body, { status, headers }) };
+}
+
+function get(headers: Record<string, string> = {}): Request {
+  return new Request("http://127.0.0.1:8960/dict-no.json", { headers });
+}
+
+describe("negotiate", () => {
+  it("prefers brotli, then gzip", () => {
+    expect(negotiate("gzip, deflate, br")).toBe("br");
+    expect(negotiate("gzip, deflate")).toBe("gzip");
+    expect(negotiate("*")).toBe("br");
+  });
+
+  it("respects q=0", () => {
+    expect(negotiate("br;q=0, gzip;q=0.5")).toBe("gzip");
+    expect(negotiate("*, br;q=0")).toBe("gzip");
+    expect(negotiate("gzip;q=0")).toBeNull();
+  });
+
+  it("returns null when nothing usable is offered", () => {
+    expect(negotiate(null)).toBeNull();
+    expect(negotiate("identity")).toBeNull();
+  });
+});
+
+describe("withCompression", () => {
+  const json = { "Content-Type": "application/json;charset=utf-8" };
+
+  it("brotli-compresses text-like responses", async () => {
+    const { handler } = serve(BIG, json);
+    const res = await withCompression(handler)(
+      get({ "Accept-Encoding": "gzip, br" }),
+    );
+    expect(res.headers.get("Content-Encoding")).toBe("br");
+    expect(res.headers.get("Vary")).toBe("Accept-Encoding");
+    const body = Buffer.from(await res.arrayBuffer());
+    expect(brotliDecompressSync(body).toString()).toBe(BIG);
+  });
+
+  it("falls back to gzip", async () => {
+    const { handler } = serve(BIG, json);
+    const res = await withCompression(handler)(
+      get({ "Accept-Encoding": "gzip" }),
+    );
+    expect(res.headers.get("Content-Encoding")).toBe("gzip");
+    const body = Buffer.from(await res.arrayBuffer());
+    expect(gunzipSync(body).toString()).toBe(BIG);
+  });
+
+  it("keeps the other headers", async () => {
+    const { handler } = serve(BIG, {
+      ...json,
+      "Cross-Origin-Embedder-Policy": "require-corp",
+    });
+    const res = await withCompression(handler)(
+      get({ "Accept-Encoding": "br" }),
+    );
+    expect(res.headers.get("Cross-Origin-Embedder-Policy")).toBe(
+      "require-corp",
+    );
+    expect(res.headers.get("Content-Type")).toBe(json["Content-Type"]);
+  });
+
+  it("reuses cached output for identical content", async () => {
+    const cache = new Map<string, Uint8Array>();
+    const { handler } = serve(BIG, json);
+    const compressed = withCompression(handler, cache);
+    await compressed(get({ "Accept-Encoding": "br" }));
+    await compressed(get({ "Accept-Encoding": "br" }));
+    expect(cache.size).toBe(1);
+    await compressed(get({ "Accept-Encoding": "gzip" }));
+    expect(cache.size).toBe(2);
+  });
+
+  it("skips reading the body on a memo key hit", async () => {
+    const cache = new Map<string, Uint8Array>();
+    let reads = 0;
+    const handler = (): Response =>
+      new Response(
+        // Pulled only when read, unlike a stream with a high water mark.
+        new ReadableStream(
+          {
+            pull(controller) {
+              reads++;
+              controller.enqueue(new TextEncoder().encode(BIG));
+              controller.close();
+            },
+          },
+          { highWaterMark: 0 },
+        ),
+        { headers: json },
+      );
+    const compressed = withCompression(handler, cache, () => "index.html");
+    const first = await compressed(get({ "Accept-Encoding": "br" }));
+    expect(reads).toBe(1);
+    const again = await compressed(get({ "Accept-Encoding": "br" }));
+    expect(reads).toBe(1);
+    expect([...cache.keys()]).toEqual(["index.html:br"]);
+    expect(again.headers.get("Content-Encoding")).toBe("br");
+    const bytes = await again.arrayBuffer();
+    expect(brotliDecompressSync(bytes).toString()).toBe(BIG);
+    expect(await first.arrayBuffer()).toEqual(bytes);
+  });
+
+  it("leaves small bodies uncompressed but still varies", async () => {
+    const { handler } = serve("{}", json);
+    const res = await withCompression(handler)(
+      get({ "Accept-Encoding": "br" }),
+    );
+    expect(res.headers.get("Content-Encoding")).toBeNull();
+    expect(res.headers.get("Vary")).toBe("Accept-Encoding");
+    expect(await res.text()).toBe("{}");
+  });
+
+  it("passes through what it should not touch", async () => {
+    const cases: [Record<string, string>, Record<string, string>, number][] =
+      [
+        [{}, json, 200],
+        [{ "Accept-Encoding": "br", Range: "bytes=0-9" }, json, 200],
+        [{ "Accept-Encoding": "br" }, json, 404],
+        [{ "Accept-Encoding": "br" }, { "Content-Type": "image/png" }, 200],
+        [{ "Accept-Encoding": "br" }, { "Content-Type": "audio/wav" }, 200],
+        [
+          { "Accept-Encoding": "br" },
+          { ...json, "Content-Encoding": "gzip" },
+          200,
+        ],
+      ];
+    for (const [reqHeaders, resHeaders, status] of cases) {
+      const { handler } = serve(BIG, resHeaders, status);
+      const res = await withCompression(handler)(get(reqHeaders));
+      expect(res.headers.get("Vary")).toBeNull();
+      expect(await res.text()).toBe(BIG);
+    }
+  });
+});
@@ -0,0 +1,65 @@
+import { describe, expect, it } from "bun:test";
+import { isOrigin, withCors } from "../server/cors";
+
+describe("isOrigin", () => {
+  it("accepts bare http and https origins only", () => {
+    expect(isOrigin("https://example.com")).toBe(true);
+    expect(isOrigin("http://localhost:5173")).toBe(true);
+    for (const raw of [
+      "example.com",
+      "https://example.com/",
+      "https://example.com/app",
+      "ftp://example.com",
+      "*",
+    ]) {
+      expect(isOrigin(raw)).toBe(false);
+    }
+  });
+});
+
+describe("withCors", () => {
+  const handler = withCors(() => new Response("ok"), ["https://app.example"]);
+  const call = (
+    path: string,
+    origin: string,
+    init: RequestInit = {},
+  ): Promise<Response> =>
+    Promise.resolve(
+      handler(
+        new Request(`http://x${path}`, {
+          ...init,
+          headers: { Origin: origin, ...init.headers },
+        }),
+      ),
+    );
+
+  it("allows listed origins on API paths", async () => {
+    const res = await call("/api/shutdown", "https://app.example");
+    expect(await res.text()).toBe("ok");
+    expect(res.headers.get("Access-Control-Allow-Origin")).toBe(
+      "https://app.example",
+    );
+    expect(res.headers.get("Vary")).toBe("Origin");
+  });
+
+  it("answers preflights itself", async () => {
+    const res = await call("/api/shutdown", "https://app.example", {
+      method: "OPTIONS",
+      headers: { "Access-Control-Request-Method": "POST" },
+    });
+    expect(res.status).toBe(204);
+    expect(res.headers.get("Access-Control-Allow-Methods")).toContain("POST");
+    expect(res.headers.get("Access-Control-Allow-Headers")).toContain(
+      "Authorization",
+    );
+  });
+
+  it("leaves other origins and static paths alone", async () => {
+    for (const res of [
+      await call("/api/shutdown", "https://evil.example"),
+      await call("/index.html", "https://app.example"),
+    ]) {
+      expect(res.headers.has("Access-Control-Allow-Origin")).toBe(false);
+    }
+  });
+});
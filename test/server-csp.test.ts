@@ -0,0 +1,57 @@
+import { describe, expect, it } from "bun:test";
+import { createHash } from "node:crypto";
+import { DEFAULT_CSP, inlineScriptHashes, withCsp } from "../server/csp";
+
+const THEME = "document.documentElement.dataset.theme='frappe'";
+const PAGE = `<!doctype html><script>${THEME}</script><script type="module" src="/app.js"></script>`;
+const HASH = `'sha256-${createHash("sha256").update(THEME).digest("base64")}'`;
+
+function html(body: string): () => Response {
+  return () => new Response(body, { headers: { "Content-Type": "text/html" } });
+}
+
+describe("inlineScriptHashes", () => {
+  it("hashes inline scripts and skips external ones", () => {
+    expect(inlineScriptHashes(PAGE)).toEqual([HASH]);
+    expect(inlineScriptHashes('<script src="/a.js"></script>')).toEqual([]);
+  });
+});
+
+describe("withCsp", () => {
+  it("allows the page's inline scripts in script-src", async () => {
+    const res = await withCsp(html(PAGE), DEFAULT_CSP)(
+      new Request("http://x/"),
+    );
+    const csp = res.headers.get("Content-Security-Policy") ?? "";
+    expect(csp).toContain(`script-src 'self' ${HASH};`);
+    expect(csp).toContain("frame-ancestors 'none'");
+    expect(await res.text()).toBe(PAGE);
+  });
+
+  it("leaves the policy alone without inline scripts", async () => {
+    const res = await withCsp(html("<p>hi"), DEFAULT_CSP)(
+      new Request("http://x/"),
+    );
+    expect(res.headers.get("Content-Security-Policy")).toBe(DEFAULT_CSP);
+  });
+
+  it("extends a custom policy's script-src, wherever it is", async () => {
+    const res = await withCsp(html(PAGE), "script-src 'self' cdn.example")(
+      new Request("http://x/"),
+    );
+    expect(res.headers.get("Content-Security-Policy")).toBe(
+      `script-src 'self' cdn.example ${HASH}`,
+    );
+  });
+
+  it("only touches HTML", async () => {
+    const js = () =>
+      new Response("x", { headers: { "Content-Type": "text/javascript" } });
+    const res = await withCsp(js, DEFAULT_CSP)(new Request("http://x/a.js"));
+    expect(res.headers.has("Content-Security-Policy")).toBe(false);
+    const bare = await withCsp(() => new Response("x"), DEFAULT_CSP)(
+      new Request("http://x/"),
+    );
+    expect(bare.headers.has("Content-Security-Policy")).toBe(false);
+  });
+});
@@ -0,0 +1,131 @@
+import { describe, expect, it } from "bun:test";
+import { etagFor, noneMatch, withEtag } from "../server/etag";
+import { assetFor } from "../server/handler";
+import { useNativeGlobals } from "./native-globals";
+
+useNativeGlobals();
+
+const BODY = "<!doctype html><title>Brainbout</title>";
+const TAG = etagFor(new TextEncoder().encode(BODY));
+
+function page(): Response {
+  return new Response(BODY, {
+    headers: {
+      "Content-Type": "text/html",
+      "Cross-Origin-Opener-Policy": "same-origin",
+    },
+  });
+}
+
+function get(
+  headers: Record<string, string> = {},
+  method = "GET",
+  path = "/",
+): Request {
+  return new Request(`http://127.0.0.1:8960${path}`, { method, headers });
+}
+
+const byPath = (req: Request): string => new URL(req.url).pathname;
+
+describe("etagFor", () => {
+  it("is a quoted, stable content hash", () => {
+    expect(TAG).toMatch(/^"[\w-]{22}"$/u);
+    expect(etagFor(new TextEncoder().encode(BODY))).toBe(TAG);
+    expect(etagFor(new TextEncoder().encode("other"))).not.toBe(TAG);
+  });
+});
+
+describe("noneMatch", () => {
+  it("matches lists, weak tags and *", () => {
+    expect(noneMatch(null, TAG)).toBe(false);
+    expect(noneMatch(`"x", ${TAG}`, TAG)).toBe(true);
+    expect(noneMatch(`W/${TAG}`, TAG)).toBe(true);
+    expect(noneMatch("*", TAG)).toBe(true);
+    expect(noneMatch('"x"', TAG)).toBe(false);
+  });
+});
+
+describe("withEtag", () => {
+  it("tags 200 responses and keeps the body", async () => {
+    const res = await withEtag(page)(get());
+    expect(res.headers.get("ETag")).toBe(TAG);
+    expect(await res.text()).toBe(BODY);
+  });
+
+  it("answers a matching If-None-Match with 304", async () => {
+    for (const memo of [undefined, byPath]) {
+      const handler = withEtag(page, memo);
+      await handler(get());
+      const res = await handler(get({ "If-None-Match": TAG }));
+      expect(res.status).toBe(304);
+      expect(res.headers.get("ETag")).toBe(TAG);
+      expect(res.headers.get("Cross-Origin-Opener-Policy")).toBe(
+        "same-origin",
+      );
+      expect(await res.text()).toBe("");
+    }
+  });
+
+  it("remembers tags per memo key and sent encoding", async () => {
+    let body = BODY;
+    // Stands in for compression, which skips Range requests.
+    const handler = withEtag((req) => {
+      const compress =
+        req.headers.has("Accept-Encoding") && !req.headers.has("Range");
+      return new Response(body, {
+        headers: compress ? { "Content-Encoding": "br" } : {},
+      });
+    }, byPath);
+    const first = await handler(get());
+    body = "changed";
+    const again = await handler(get());
+    expect(again.headers.get("ETag")).toBe(first.headers.get("ETag"));
+    expect(await again.text()).toBe("changed");
+    const br = await handler(get({ "Accept-Encoding": "br" }));
+    expect(br.headers.get("ETag")).toBe(
+      etagFor(new TextEncoder().encode(body)),
+    );
+    const ranged = await handler(
+      get({ "Accept-Encoding": "br", Range: "bytes=0-1" }),
+    );
+    expect(ranged.headers.get("ETag")).toBe(first.headers.get("ETag"));
+  });
+
+  it("shares one memo entry between paths that fall back", async () => {
+    const files = { "/index.html": "dist/index.html" };
+    let body = BODY;
+    const handler = withEtag(
+      () => new Response(body),
+      (req) => assetFor(files, new URL(req.url).pathname),
+    );
+    const a = await handler(get({}, "GET", "/a"));
+    // A rehash would change the tag, so equal tags mean one shared entry.
+    body = "changed";
+    const b = await handler(get({}, "GET", "/b"));
+    const c = await handler(get({}, "GET", "/c"));
+    expect(b.headers.get("ETag")).toBe(a.headers.get("ETag"));
+    expect(c.headers.get("ETag")).toBe(a.headers.get("ETag"));
+  });
+
+  it("rehashes every time without memo", async () => {
+    let body = BODY;
+    const handler = withEtag(() => new Response(body));
+    await handler(get());
+    body = "changed";
+    const res = await handler(get({ "If-None-Match": TAG }));
+    expect(res.status).toBe(200);
+  });
+
+  it("leaves other methods, statuses and tagged responses alone", async () => {
+    const post = await withEtag(page)(get({}, "POST"));
+    expect(post.headers.has("ETag")).toBe(false);
+    const missing = await withEtag(
+      () => new Response("", { status: 404 }),
+    )(get());
+    expect(missing.headers.has("ETag")).toBe(false);
+    const tagged = await withEtag(
+      () => new Response("", { headers: { ETag: '"mine"' } }),
+    )(get());
+    expect(tagged.headers.get("ETag")).toBe('"mine"');
+  });
+});
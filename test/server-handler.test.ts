@@ -0,0 +1,179 @@
+import { afterAll, describe, expect, it } from "bun:test";
+import { mkdirSync, mkdtempSync, rmSync, writeFileSync } from "node:fs";
+import { tmpdir } from "node:os";
+import { join } from "node:path";
+import {
+  assets,
+  directory,
+  healthz,
+  ISOLATION_HEADERS,
+  missingIndex,
+  mux,
+  overlay,
+  version,
+  withHeaders,
+} from "../server/handler";
+import { BUILD } from "../server/version";
+import { useNativeGlobals } from "./native-globals";
+
+useNativeGlobals();
+
+const dir = mkdtempSync(join(tmpdir(), "brainbout-test-"));
+const index = join(dir, "index.html");
+const app = join(dir, "app.js");
+writeFileSync(index, "<!doctype html>");
+writeFileSync(app, "console.log(1);");
+
+afterAll(() => {
+  rmSync(dir, { recursive: true, force: true });
+});
+
+function get(path: string): Request {
+  return new Request(`http://127.0.0.1:8960${path}`);
+}
+
+describe("mux", () => {
+  const handler = mux(
+    { "/healthz": () => new Response("health") },
+    () => new Response("fallback"),
+  );
+
+  it("dispatches exact paths", async () => {
+    expect(await (await handler(get("/healthz"))).text()).toBe("health");
+  });
+
+  it("sends everything else to the fallback", async () => {
+    expect(await (await handler(get("/healthz/x"))).text()).toBe("fallback");
+    expect(await (await handler(get("/"))).text()).toBe("fallback");
+  });
+});
+
+describe("withHeaders", () => {
+  it("adds headers to every response", async () => {
+    const handler = withHeaders(() => new Response("ok"), ISOLATION_HEADERS);
+    const res = await handler(get("/"));
+    expect(res.headers.get("Cross-Origin-Opener-Policy")).toBe("same-origin");
+    expect(res.headers.get("Cross-Origin-Embedder-Policy")).toBe(
+      "require-corp",
+    );
+  });
+});
+
+describe("assets", () => {
+  const handler = assets({ "/index.html": index, "/app.js": app });
+
+  it("serves files by path", async () => {
+    expect(await (await handler(get("/app.js"))).text()).toBe(
+      "console.log(1);",
+    );
+  });
+
+  it("falls back to index.html", async () => {
+    expect(await (await handler(get("/games/lex"))).text()).toBe(
+      "<!doctype html>",
+    );
+  });
+
+  it("404s when there is no index.html", async () => {
+    const res = await assets({})(get("/"));
+    expect(res.status).toBe(404);
+  });
+});
+
+describe("directory", () => {
+  const handler = directory(dir);
+
+  it("serves files from disk", async () => {
+    expect(await (await handler(get("/app.js"))).text()).toBe(
+      "console.log(1);",
+    );
+  });
+
+  it("picks up edits without a restart", async () => {
+    const path = join(dir, "live.css");
+    writeFileSync(path, "a{}");
+    expect(await (await handler(get("/live.css"))).text()).toBe("a{}");
+    writeFileSync(path, "b{}");
+    expect(await (await handler(get("/live.css"))).text()).toBe("b{}");
+  });
+
+  it("falls back to index.html for unknown paths and directories", async () => {
+    expect(await (await handler(get("/games/lex"))).text()).toBe(
+      "<!doctype html>",
+    );
+    expect(await (await handler(get("/"))).text()).toBe("<!doctype html>");
+  });
+
+  it("refuses to escape the directory", async () => {
+    const res = await handler(get("/%2e%2e%2fsecret"));
+    expect(res.status).toBe(404);
+  });
+
+  it("rejects malformed escapes", async () => {
+    expect((await handler(get("/%E0%A4%A"))).status).toBe(400);
+  });
+
+  it("404s when the directory has no index.html", async () => {
+    const res = await directory(join(dir, "missing"))(get("/"));
+    expect(res.status).toBe(404);
+  });
+});
+
+describe("overlay", () => {
+  const root = join(dir, "overlay");
+  mkdirSync(root);
+  writeFileSync(join(root, "theme.css"), "body{}");
+  writeFileSync(join(root, "index.html"), "<!doctype html><p>custom");
+  const handler = overlay(root, () => new Response("embedded"));
+  const text = async (path: string): Promise<string> =>
+    (await handler(get(path))).text();
+
+  it("serves files that exist in the overlay", async () => {
+    expect(await text("/theme.css")).toBe("body{}");
+    expect(await text("/")).toBe("<!doctype html><p>custom");
+  });
+
+  it("falls through for everything else", async () => {
+    expect(await text("/app.js")).toBe("embedded");
+    expect(await text("/games/")).toBe("embedded");
+  });
+
+  it("never looks outside the overlay", async () => {
+    expect(await text("/%2e%2e%2fapp.js")).toBe("embedded");
+    expect(await text("/..%5capp.js")).toBe("embedded");
+  });
+
+  it("rejects malformed escapes", async () => {
+    expect((await handler(get("/%E0%A4%A"))).status).toBe(400);
+  });
+});
+
+describe("missingIndex", () => {
+  it("accepts embedded assets or a dev dir with an index.html", () => {
+    expect(missingIndex({ "/index.html": index }, "")).toBe("");
+    expect(missingIndex({}, dir)).toBe("");
+  });
+
+  it("explains a binary built without assets", () => {
+    expect(missingIndex({}, "")).toContain("bun run build:server");
+  });
+
+  it("explains a dev dir without an index.html", () => {
+    const missing = join(dir, "missing");
+    expect(missingIndex({}, missing)).toContain(`--dev-dir ${missing}`);
+  });
+});
+
+describe("healthz", () => {
+  it("reports ok as JSON", async () => {
+    const res = healthz();
+    expect(res.status).toBe(200);
+    expect(await res.json()).toEqual({ status: "ok" });
+  });
+});
+
+describe("version", () => {
+  it("reports the build info as JSON", async () => {
+    expect(await version().json()).toEqual(BUILD);
+  });
+});
@@ -0,0 +1,73 @@
+import { afterEach, beforeEach, describe, expect, it, jest } from "bun:test";
+import { createIdleTimer, withActivity } from "../server/idle";
+
+let clock = 0;
+const now = (): number => clock;
+
+beforeEach(() => {
+  clock = 0;
+  jest.useFakeTimers();
+});
+
+afterEach(() => {
+  jest.useRealTimers();
+});
+
+function advance(ms: number): void {
+  clock += ms;
+  jest.advanceTimersByTime(ms);
+}
+
+describe("createIdleTimer", () => {
+  it("fires once after the timeout without activity", () => {
+    const onIdle = jest.fn<() => void>();
+    createIdleTimer(10_000, onIdle, now);
+
+    advance(9000);
+    expect(onIdle).not.toHaveBeenCalled();
+    advance(1000);
+    expect(onIdle).toHaveBeenCalledTimes(1);
+    advance(60_000);
+    expect(onIdle).toHaveBeenCalledTimes(1);
+  });
+
+  it("is pushed back by activity", () => {
+    const onIdle = jest.fn<() => void>();
+    const timer = createIdleTimer(10_000, onIdle, now);
+
+    advance(8000);
+    timer.touch();
+    advance(8000);
+    expect(onIdle).not.toHaveBeenCalled();
+    advance(2000);
+    expect(onIdle).toHaveBeenCalledTimes(1);
+  });
+
+  it("never fires once stopped", () => {
+    const onIdle = jest.fn<() => void>();
+    createIdleTimer(10_000, onIdle, now).stop();
+
+    advance(60_000);
+    expect(onIdle).not.toHaveBeenCalled();
+  });
+
+  it("defaults to the wall clock", () => {
+    const onIdle = jest.fn<() => void>();
+    createIdleTimer(10_000, onIdle).stop();
+    expect(onIdle).not.toHaveBeenCalled();
+  });
+});
+
+describe("withActivity", () => {
+  it("touches the timer before and after each request", async () => {
+    const touch = jest.fn<() => void>();
+    const timer = { touch, stop: () => undefined };
+    const handler = withActivity(() => {
+      expect(touch).toHaveBeenCalledTimes(1);
+      return new Response("ok");
+    }, timer);
+
+    await handler(new Request("http://127.0.0.1:8960/"));
+    expect(touch).toHaveBeenCalledTimes(2);
+  });
+});
@@ -0,0 +1,155 @@
+import { afterAll, beforeEach, describe, expect, it } from "bun:test";
+import {
+  existsSync,
+  mkdtempSync,
+  readdirSync,
+  readFileSync,
+  rmSync,
+  writeFileSync,
+} from "node:fs";
+import { tmpdir } from "node:os";
+import { join } from "node:path";
+import process from "node:process";
+import {
+  acquireLock,
+  lockPath,
+  processAlive,
+  writeAddrFile,
+} from "../server/instance";
+
+const dir = mkdtempSync(join(tmpdir(), "brainbout-test-"));
+const path = join(dir, "brainbout-8960.lock");
+const alive = (): boolean => true;
+const dead = (): boolean => false;
+
+beforeEach(() => {
+  rmSync(path, { force: true });
+});
+
+afterAll(() => {
+  rmSync(dir, { recursive: true, force: true });
+});
+
+describe("acquireLock", () => {
+  it("hands the lock to the first caller only", () => {
+    const first = acquireLock(path, 100, alive);
+    const second = acquireLock(path, 200, alive);
+    expect(first.ok).toBe(true);
+    expect(second).toEqual({ ok: false, holder: { pid: 100, url: "" } });
+  });
+
+  it("tells later callers the published URL", () => {
+    const first = acquireLock(path, 100, alive);
+    if (first.ok) {
+      first.lock.publish("http://127.0.0.1:8960");
+    }
+    expect(acquireLock(path, 200, alive)).toEqual({
+      ok: false,
+      holder: { pid: 100, url: "http://127.0.0.1:8960" },
+    });
+  });
+
+  it("removes the lock file on release", () => {
+    const first = acquireLock(path, 100, alive);
+    if (first.ok) {
+      first.lock.release();
+    }
+    expect(existsSync(path)).toBe(false);
+    expect(acquireLock(path, 200, alive).ok).toBe(true);
+  });
+
+  it("does not release a lock someone else now holds", () => {
+    const first = acquireLock(path, 100, alive);
+    writeFileSync(path, JSON.stringify({ pid: 300, url: "" }));
+    if (first.ok) {
+      first.lock.release();
+    }
+    expect(existsSync(path)).toBe(true);
+  });
+
+  it("reclaims a lock left by a dead process", () => {
+    acquireLock(path, 100, alive);
+    expect(acquireLock(path, 200, dead).ok).toBe(true);
+    expect(JSON.parse(readFileSync(path, "utf-8"))).toEqual({
+      pid: 200,
+      url: "",
+    });
+  });
+
+  it("leaves a freshly unreadable lock alone", () => {
+    writeFileSync(path, "");
+    expect(acquireLock(path, 200, dead)).toEqual({
+      ok: false,
+      holder: { pid: 0, url: "" },
+    });
+    expect(readFileSync(path, "utf-8")).toBe("");
+  });
+
+  it("reclaims a lock that has stayed unreadable", () => {
+    writeFileSync(path, "garbage");
+    const later = (): number => Date.now() + 60_000;
+    expect(acquireLock(path, 200, alive, later).ok).toBe(true);
+  });
+
+  it("never shows a half-written lock", () => {
+    const first = acquireLock(path, 100, alive);
+    if (first.ok) {
+      first.lock.publish("http://127.0.0.1:8960");
+    }
+    expect(readdirSync(dir).filter((f) => f.endsWith(".tmp"))).toEqual([]);
+    expect(acquireLock(path, 200, alive).ok).toBe(false);
+  });
+
+  it("treats a lock without a URL as still starting", () => {
+    writeFileSync(path, JSON.stringify({ pid: 100 }));
+    expect(acquireLock(path, 200, alive)).toEqual({
+      ok: false,
+      holder: { pid: 100, url: "" },
+    });
+  });
+
+  it("rethrows errors other than an existing lock", () => {
+    expect(() => acquireLock(join(dir, "missing", "x.lock"))).toThrow();
+  });
+});
+
+describe("lockPath", () => {
+  it("prefers the per-user runtime directory", () => {
+    expect(lockPath(8960, { XDG_RUNTIME_DIR: "/run/user/1000" }, 1000)).toBe(
+      join("/run/user/1000", "brainbout-8960.lock"),
+    );
+  });
+
+  it("puts the uid in the name in the shared temp directory", () => {
+    expect(lockPath(8960, {}, 1000)).toBe(
+      join(tmpdir(), "1000-brainbout-8960.lock"),
+    );
+    expect(lockPath(8960, {}, null)).toBe(
+      join(tmpdir(), "brainbout-8960.lock"),
+    );
+  });
+});
+
+describe("processAlive", () => {
+  it("sees the current process", () => {
+    expect(processAlive(process.pid)).toBe(true);
+  });
+
+  it("does not see a pid that cannot exist", () => {
+    expect(processAlive(2 ** 30)).toBe(false);
+  });
+});
+
+describe("writeAddrFile", () => {
+  const addr = join(dir, "addr");
+
+  it("writes the URL, replacing any old file, and removes it", () => {
+    writeFileSync(addr, "http://127.0.0.1:1/\n");
+    const remove = writeAddrFile(addr, "http://127.0.0.1:40123", 100);
+    expect(readFileSync(addr, "utf-8")).toBe("http://127.0.0.1:40123\n");
+    expect(existsSync(`${addr}.100.tmp`)).toBe(false);
+    remove();
+    expect(existsSync(addr)).toBe(false);
+    remove();
+  });
+});
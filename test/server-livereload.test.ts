@@ -0,0 +1,88 @@
+import { afterAll, afterEach, describe, expect, it, jest } from "bun:test";
+import { mkdtempSync, rmSync, writeFileSync } from "node:fs";
+import { tmpdir } from "node:os";
+import { join } from "node:path";
+import {
+  debounce,
+  injectSnippet,
+  LIVERELOAD_PATH,
+  watchDir,
+  withLiveReload,
+} from "../server/livereload";
+import { useNativeGlobals } from "./native-globals";
+
+useNativeGlobals();
+
+const dir = mkdtempSync(join(tmpdir(), "brainbout-test-"));
+
+afterAll(() => {
+  rmSync(dir, { recursive: true, force: true });
+});
+
+describe("injectSnippet", () => {
+  it("goes before </body>, or at the end without one", () => {
+    const page = injectSnippet("<body><p>hi</p></body></html>");
+    expect(page).toStartWith("<body><p>hi</p><script>");
+    expect(page).toEndWith("</script></body></html>");
+    expect(page).toContain(LIVERELOAD_PATH);
+    expect(injectSnippet("<p>hi")).toStartWith("<p>hi<script>");
+  });
+});
+
+describe("withLiveReload", () => {
+  it("injects into HTML only", async () => {
+    const html = withLiveReload(
+      () =>
+        new Response("<body></body>", {
+          headers: { "Content-Type": "text/html;charset=utf-8" },
+        }),
+    );
+    const page = await (await html(new Request("http://x/"))).text();
+    expect(page).toContain(LIVERELOAD_PATH);
+    const js = withLiveReload(() => new Response("let x;"));
+    expect(await (await js(new Request("http://x/a.js"))).text()).toBe(
+      "let x;",
+    );
+  });
+});
+
+describe("debounce", () => {
+  afterEach(() => {
+    jest.useRealTimers();
+  });
+
+  it("fires once after a burst, and not at all when cancelled", () => {
+    jest.useFakeTimers();
+    const fn = jest.fn<() => void>();
+    const d = debounce(fn, 100);
+    d.call();
+    jest.advanceTimersByTime(50);
+    d.call();
+    d.call();
+    jest.advanceTimersByTime(99);
+    expect(fn).not.toHaveBeenCalled();
+    jest.advanceTimersByTime(1);
+    expect(fn).toHaveBeenCalledTimes(1);
+    d.call();
+    d.cancel();
+    jest.advanceTimersByTime(1000);
+    expect(fn).toHaveBeenCalledTimes(1);
+  });
+});
+
+describe("watchDir", () => {
+  it("reports changes under the directory", async () => {
+    const changed = new Promise<void>((resolve) => {
+      const stop = watchDir(
+        dir,
+        () => {
+          stop();
+          resolve();
+        },
+        10,
+      );
+    });
+    writeFileSync(join(dir, "index.html"), "<p>new</p>");
+    await changed;
+  });
+});
@@ -0,0 +1,91 @@
+import { describe, expect, it, spyOn } from "bun:test";
+import process from "node:process";
+import { createLogger, type LoggerOptions } from "../server/log";
+
+function capture(opts: Omit<LoggerOptions, "write">): {
+  lines: string[];
+  log: ReturnType<typeof createLogger>;
+} {
+  const lines: string[] = [];
+  const log = createLogger({
+    ...opts,
+    write: (line) => {
+      lines.push(line);
+    },
+  });
+  return { lines, log };
+}
+
+describe("createLogger", () => {
+  it("writes plain text records with key=value attrs", () => {
+    const { lines, log } = capture({ level: "info", format: "text" });
+    log.info("Serving on http://127.0.0.1:8960", {
+      addr: "127.0.0.1",
+      port: 8960,
+    });
+    expect(lines).toEqual([
+      "Serving on http://127.0.0.1:8960 addr=127.0.0.1 port=8960",
+    ]);
+  });
+
+  it("prefixes warnings and errors in text", () => {
+    const { lines, log } = capture({ level: "info", format: "text" });
+    log.warn("careful");
+    log.error("broken", { ok: false });
+    expect(lines).toEqual(["WARN careful", "ERROR broken ok=false"]);
+  });
+
+  it("quotes text values that need it", () => {
+    const { lines, log } = capture({ level: "info", format: "text" });
+    log.info("x", { a: "two words", b: "", c: 'say "hi"', d: "k=v" });
+    expect(lines).toEqual([
+      'x a="two words" b="" c="say \\"hi\\"" d="k=v"',
+    ]);
+  });
+
+  it("drops records below the configured level", () => {
+    const { lines, log } = capture({ level: "warn", format: "text" });
+    log.debug("d");
+    log.info("i");
+    log.warn("w");
+    log.error("e");
+    expect(lines).toEqual(["WARN w", "ERROR e"]);
+  });
+
+  it("changes level with setLevel", () => {
+    const { lines, log } = capture({ level: "warn", format: "text" });
+    log.info("before");
+    log.setLevel("info");
+    log.info("after");
+    expect(lines).toEqual(["after"]);
+  });
+
+  it("emits debug records at debug level", () => {
+    const { lines, log } = capture({ level: "debug", format: "text" });
+    log.debug("d");
+    expect(lines).toEqual(["d"]);
+  });
+
+  it("writes JSON records with time and level", () => {
+    const now = new Date("2026-01-01T00:00:00Z");
+    const { lines, log } = capture({
+      level: "info",
+      format: "json",
+      now: () => now,
+    });
+    log.info("serving", { port: 8960 });
+    expect(JSON.parse(lines[0]!)).toEqual({
+      time: "2026-01-01T00:00:00.000Z",
+      level: "info",
+      msg: "serving",
+      port: 8960,
+    });
+  });
+
+  it("writes to stderr by default", () => {
+    const spy = spyOn(process.stderr, "write").mockImplementation(() => true);
+    createLogger({ level: "info", format: "text" }).info("hello");
+    expect(spy).toHaveBeenCalledWith("hello\n");
+    spy.mockRestore();
+  });
+});
@@ -0,0 +1,151 @@
+import { describe, expect, it } from "bun:test";
+import {
+  asksForUs,
+  encodeName,
+  encodeResponse,
+  HOST,
+  INSTANCE,
+  parseQuestions,
+  records,
+  SERVICE,
+  TYPE,
+} from "../server/mdns";
+
+function query(...questions: [number[], number][]): Uint8Array {
+  return Uint8Array.from([
+    ...[0, 0, 0, 0, 0, questions.length, 0, 0, 0, 0, 0, 0],
+    ...questions.flatMap(([name, type]) => [...name, 0, 0, type, 0, 1]),
+  ]);
+}
+
+describe("encodeName", () => {
+  it("writes length-prefixed labels", () => {
+    expect(encodeName("brainbout.local")).toEqual([
+      9, 98, 114, 97, 105, 110, 98, 111, 117, 116, 5, 108, 111, 99, 97, 108, 0,
+    ]);
+  });
+});
+
+describe("records", () => {
+  const rrs = records(8960, ["192.168.1.20"]);
+
+  it("points the service at the instance", () => {
+    expect(rrs[0]).toMatchObject({
+      name: SERVICE,
+      type: TYPE.PTR,
+      unique: false,
+      data: encodeName(INSTANCE),
+    });
+  });
+
+  it("gives the port in the SRV record", () => {
+    expect(rrs[1]).toMatchObject({
+      name: INSTANCE,
+      type: TYPE.SRV,
+      data: [0, 0, 0, 0, 0x23, 0x00, ...encodeName(HOST)],
+    });
+  });
+
+  it("adds one A record per address", () => {
+    expect(rrs.slice(3)).toEqual([
+      {
+        name: HOST,
+        type: TYPE.A,
+        unique: true,
+        ttl: 120,
+        data: [192, 168, 1, 20],
+      },
+    ]);
+  });
+
+  it("uses TTL 0 for goodbyes", () => {
+    expect(records(8960, [], 0).every((r) => r.ttl === 0)).toBe(true);
+  });
+});
+
+describe("encodeResponse", () => {
+  it("writes an authoritative answer-only header", () => {
+    const packet = encodeResponse(records(8960, ["10.0.0.5"]));
+    expect([...packet.subarray(0, 12)]).toEqual([
+      0, 0, 0x84, 0, 0, 0, 0, 4, 0, 0, 0, 0,
+    ]);
+  });
+
+  it("sets the cache-flush bit on unique records", () => {
+    const [a] = records(8960, ["10.0.0.5"]).slice(3);
+    const packet = encodeResponse([a!]);
+    const at = 12 + encodeName(HOST).length;
+    expect([...packet.subarray(at, at + 10)]).toEqual([
+      0, 1, 0x80, 1, 0, 0, 0, 120, 0, 4,
+    ]);
+    expect([...packet.subarray(at + 10)]).toEqual([10, 0, 0, 5]);
+  });
+});
+
+describe("parseQuestions", () => {
+  it("reads names and types", () => {
+    expect(
+      parseQuestions(query([encodeName(SERVICE).slice(0, -1), TYPE.PTR])),
+    ).toEqual([{ name: SERVICE, type: TYPE.PTR }]);
+  });
+
+  it("follows compression pointers and lowercases", () => {
+    const first = encodeName("Brainbout.local").slice(0, -1);
+    // Second question: "www" + pointer to "local" in the first one.
+    const local = 12 + 1 + "Brainbout".length;
+    const second = [3, 119, 119, 119, 0xc0, local];
+    const packet = Uint8Array.from([
+      ...[0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0],
+      ...first,
+      0,
+      0,
+      TYPE.A,
+      0,
+      1,
+      ...second,
+      0,
+      TYPE.A,
+      0,
+      1,
+    ]);
+    expect(parseQuestions(packet)).toEqual([
+      { name: "brainbout.local", type: TYPE.A },
+      { name: "www.local", type: TYPE.A },
+    ]);
+  });
+
+  it("ignores responses and runt packets", () => {
+    expect(parseQuestions(encodeResponse(records(8960, [])))).toEqual([]);
+    expect(parseQuestions(new Uint8Array(4))).toEqual([]);
+  });
+
+  it("keeps what parsed before a truncated question", () => {
+    const good = query([encodeName(HOST).slice(0, -1), TYPE.A]);
+    const packet = Uint8Array.from([...good, 9, 98]);
+    packet[5] = 2;
+    expect(parseQuestions(packet)).toEqual([{ name: HOST, type: TYPE.A }]);
+  });
+
+  it("stops at a question missing its type", () => {
+    const packet = query([encodeName(HOST).slice(0, -1), TYPE.A]);
+    expect(parseQuestions(packet.subarray(0, packet.length - 2))).toEqual([]);
+  });
+
+  it("survives compression loops", () => {
+    const packet = Uint8Array.from([
+      ...[0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0],
+      0xc0,
+      12,
+    ]);
+    expect(parseQuestions(packet)).toEqual([]);
+  });
+});
+
+describe("asksForUs", () => {
+  it("matches any of our names", () => {
+    for (const name of [SERVICE, INSTANCE.toLowerCase(), HOST]) {
+      expect(asksForUs([{ name, type: 255 }])).toBe(true);
+    }
+    expect(asksForUs([{ name: "_http._tcp.local", type: 12 }])).toBe(false);
+  });
+});
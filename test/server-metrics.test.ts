@@ -0,0 +1,83 @@
+import { describe, expect, it } from "bun:test";
+import { createMetrics, metricsHandler, withMetrics } from "../server/metrics";
+
+function ticks(...values: number[]): () => number {
+  return () => values.shift() ?? 0;
+}
+
+describe("createMetrics", () => {
+  it("renders counters by status class and a cumulative histogram", () => {
+    const m = createMetrics();
+    m.observe(200, 0.003);
+    m.observe(204, 0.2);
+    m.observe(404, 12);
+    const text = m.render({});
+    expect(text).toContain('brainbout_requests_total{code="2xx"} 2\n');
+    expect(text).toContain('brainbout_requests_total{code="4xx"} 1\n');
+    expect(text).toContain(
+      'brainbout_request_duration_seconds_bucket{le="0.005"} 1\n',
+    );
+    expect(text).toContain(
+      'brainbout_request_duration_seconds_bucket{le="0.25"} 2\n',
+    );
+    expect(text).toContain(
+      'brainbout_request_duration_seconds_bucket{le="10"} 2\n',
+    );
+    expect(text).toContain(
+      'brainbout_request_duration_seconds_bucket{le="+Inf"} 3\n',
+    );
+    expect(text).toContain("brainbout_request_duration_seconds_count 3\n");
+    expect(text.indexOf('"2xx"')).toBeLessThan(text.indexOf('"4xx"'));
+  });
+
+  it("appends gauges", () => {
+    const text = createMetrics().render({
+      websockets: { help: "Open WebSocket connections.", value: 2 },
+    });
+    expect(text).toEndWith(
+      "# HELP brainbout_websockets Open WebSocket connections.\n" +
+        "# TYPE brainbout_websockets gauge\n" +
+        "brainbout_websockets 2\n",
+    );
+  });
+});
+
+describe("withMetrics", () => {
+  it("observes status and latency", async () => {
+    const m = createMetrics();
+    const handler = withMetrics(
+      () => new Response("x", { status: 201 }),
+      m,
+      ticks(1000, 1250),
+    );
+    await handler(new Request("http://x/"));
+    const text = m.render({});
+    expect(text).toContain('{code="2xx"} 1');
+    expect(text).toContain("brainbout_request_duration_seconds_sum 0.25\n");
+  });
+
+  it("counts a throwing handler as 5xx", async () => {
+    const m = createMetrics();
+    const handler = withMetrics(
+      () => {
+        throw new Error("boom");
+      },
+      m,
+      ticks(0, 0),
+    );
+    await expect(
+      Promise.resolve(handler(new Request("http://x/"))),
+    ).rejects.toThrow("boom");
+    expect(m.render({})).toContain('{code="5xx"} 1');
+  });
+});
+
+describe("metricsHandler", () => {
+  it("serves the exposition format", async () => {
+    const res = await metricsHandler(createMetrics(), () => ({
+      websockets: { help: "Open.", value: 0 },
+    }))(new Request("http://x/metrics"));
+    expect(res.headers.get("Content-Type")).toStartWith("text/plain");
+    expect(await res.text()).toContain("brainbout_websockets 0");
+  });
+});
@@ -0,0 +1,255 @@
+import { afterAll, describe, expect, it } from "bun:test";
+import { existsSync, mkdtempSync, rmSync, writeFileSync } from "node:fs";
+import { createServer } from "node:net";
+import { type NetworkInterfaceInfo, tmpdir } from "node:os";
+import { join } from "node:path";
+import {
+  browseHost,
+  formatUrl,
+  hostPort,
+  isLocalUrl,
+  isLoopback,
+  lanAddresses,
+  listenError,
+  listenWithFallback,
+  pageUrl,
+  removeStaleSocket,
+  triedPort,
+} from "../server/network";
+
+function iface(
+  address: string,
+  family: "IPv4" | "IPv6",
+  internal = false,
+): NetworkInterfaceInfo {
+  return {
+    address,
+    family,
+    internal,
+    netmask: "",
+    mac: "00:00:00:00:00:00",
+    cidr: null,
+    ...(family === "IPv6" ? { scopeid: 0 } : {}),
+  } as NetworkInterfaceInfo;
+}
+
+const INTERFACES = {
+  lo: [iface("127.0.0.1", "IPv4", true), iface("::1", "IPv6", true)],
+  eth0: [iface("192.168.1.20", "IPv4"), iface("fe80::1", "IPv6")],
+  wlan0: [iface("10.0.0.5", "IPv4")],
+  down: undefined,
+};
+
+describe("isLoopback", () => {
+  it("recognises loopback hosts", () => {
+    for (const host of ["127.0.0.1", "127.1.2.3", "localhost", "::1"]) {
+      expect(isLoopback(host)).toBe(true);
+    }
+  });
+
+  it("treats wildcard and LAN addresses as exposed", () => {
+    for (const host of ["0.0.0.0", "::", "192.168.1.20"]) {
+      expect(isLoopback(host)).toBe(false);
+    }
+  });
+});
+
+describe("isLocalUrl", () => {
+  it("accepts http and https on loopback", () => {
+    for (const url of [
+      "http://127.0.0.1:8960",
+      "https://localhost:8960/games/",
+      "http://[::1]:8960",
+    ]) {
+      expect(isLocalUrl(url)).toBe(true);
+    }
+  });
+
+  it("rejects other hosts, schemes and junk", () => {
+    for (const url of [
+      "https://evil.example",
+      "http://192.168.1.20:8960",
+      "file:///etc/passwd",
+      "javascript:alert(1)",
+      "not a url",
+    ]) {
+      expect(isLocalUrl(url)).toBe(false);
+    }
+  });
+});
+
+describe("formatUrl", () => {
+  it("brackets IPv6 hosts", () => {
+    expect(formatUrl("http", "127.0.0.1", 8960)).toBe("http://127.0.0.1:8960");
+    expect(formatUrl("https", "::1", 443)).toBe("https://[::1]:443");
+  });
+});
+
+describe("hostPort", () => {
+  it("brackets IPv6 hosts and accepts port ranges", () => {
+    expect(hostPort("0.0.0.0", 80)).toBe("0.0.0.0:80");
+    expect(hostPort("::", "8960-8969")).toBe("[::]:8960-8969");
+  });
+});
+
+describe("pageUrl", () => {
+  it("joins and encodes the path", () => {
+    expect(pageUrl("http://127.0.0.1:8960", "/")).toBe("http://127.0.0.1:8960/");
+    expect(pageUrl("https://[::1]:443", "/games/lex.html?q=a b#top")).toBe(
+      "https://[::1]/games/lex.html?q=a%20b#top",
+    );
+    expect(pageUrl("http://127.0.0.1:8960", "/lex.html?a=1&b=2")).toBe(
+      "http://127.0.0.1:8960/lex.html?a=1&b=2",
+    );
+    expect(pageUrl("https://example.com/bb", "/games/")).toBe(
+      "https://example.com/bb/games/",
+    );
+  });
+});
+
+describe("browseHost", () => {
+  it("maps wildcard binds to loopback", () => {
+    expect(browseHost("0.0.0.0")).toBe("127.0.0.1");
+    expect(browseHost("::")).toBe("127.0.0.1");
+    expect(browseHost("192.168.1.20")).toBe("192.168.1.20");
+  });
+});
+
+describe("lanAddresses", () => {
+  it("lists external IPv4 interfaces for a wildcard bind", () => {
+    expect(lanAddresses("0.0.0.0", INTERFACES)).toEqual([
+      "192.168.1.20",
+      "10.0.0.5",
+    ]);
+  });
+
+  it("returns the bound host for a specific address", () => {
+    expect(lanAddresses("10.0.0.5", INTERFACES)).toEqual(["10.0.0.5"]);
+  });
+
+  it("returns nothing for loopback", () => {
+    expect(lanAddresses("127.0.0.1", INTERFACES)).toEqual([]);
+  });
+});
+
+function addrInUse(): Error {
+  return Object.assign(new Error("in use"), { code: "EADDRINUSE" });
+}
+
+describe("listenWithFallback", () => {
+  it("moves to the next port while the address is in use", () => {
+    const tried: number[] = [];
+    const port = listenWithFallback(8960, 10, (p) => {
+      tried.push(p);
+      if (p < 8962) {
+        throw addrInUse();
+      }
+      return p;
+    });
+    expect(port).toBe(8962);
+    expect(tried).toEqual([8960, 8961, 8962]);
+  });
+
+  it("gives up after the given number of attempts", () => {
+    const tried: number[] = [];
+    let thrown: unknown;
+    try {
+      listenWithFallback(8960, 3, (p) => {
+        tried.push(p);
+        throw addrInUse();
+      });
+    } catch (err) {
+      thrown = err;
+    }
+    expect((thrown as Error).message).toBe("in use");
+    expect(tried).toEqual([8960, 8961, 8962]);
+    expect(triedPort(thrown)).toBe(8962);
+  });
+
+  it("does not run past the last port", () => {
+    const tried: number[] = [];
+    expect(() =>
+      listenWithFallback(65_535, 10, (p) => {
+        tried.push(p);
+        throw addrInUse();
+      }),
+    ).toThrow("in use");
+    expect(tried).toEqual([65_535]);
+  });
+
+  it("rethrows other errors immediately", () => {
+    let calls = 0;
+    const denied = new Error("permission denied");
+    expect(() =>
+      listenWithFallback(80, 10, () => {
+        calls++;
+        throw denied;
+      }),
+    ).toThrow("permission denied");
+    expect(calls).toBe(1);
+    expect(triedPort(denied)).toBe(80);
+    expect(triedPort(new Error("elsewhere"))).toBe(undefined);
+  });
+});
+
+describe("removeStaleSocket", () => {
+  const dir = mkdtempSync(join(tmpdir(), "brainbout-test-"));
+
+  afterAll(() => {
+    rmSync(dir, { recursive: true, force: true });
+  });
+
+  it("ignores a missing path", () => {
+    expect(() => removeStaleSocket(join(dir, "none.sock"))).not.toThrow();
+  });
+
+  it("removes a leftover socket", async () => {
+    const path = join(dir, "old.sock");
+    const server = createServer();
+    await new Promise<void>((resolve) => {
+      server.listen(path, resolve);
+    });
+    removeStaleSocket(path);
+    expect(existsSync(path)).toBe(false);
+    server.close();
+  });
+
+  it("refuses to delete a regular file", () => {
+    const path = join(dir, "notes.txt");
+    writeFileSync(path, "keep me");
+    expect(() => removeStaleSocket(path)).toThrow("not a socket");
+    expect(existsSync(path)).toBe(true);
+  });
+});
+
+describe("listenError", () => {
+  const err = (code: string): Error =>
+    Object.assign(new Error(`listen ${code}`), { code });
+
+  it("explains privileged ports", () => {
+    const e = listenError(err("EACCES"), "0.0.0.0:80", 80);
+    expect(e.message).toBe(
+      "cannot listen on 0.0.0.0:80: permission denied; ports below 1024 " +
+        "need root or CAP_NET_BIND_SERVICE, so try a higher --port",
+    );
+    expect(e.cause).toBeInstanceOf(Error);
+    expect(listenError(err("EACCES"), "unix:/run/x").message).toBe(
+      "cannot listen on unix:/run/x: permission denied",
+    );
+  });
+
+  it("explains busy and missing addresses", () => {
+    expect(listenError(err("EADDRINUSE"), "h:1").message).toContain(
+      "address in use",
+    );
+    expect(listenError(err("EADDRNOTAVAIL"), "h:1").message).toContain(
+      "check --host",
+    );
+  });
+
+  it("falls back to the original message", () => {
+    expect(listenError(err("EINVAL"), "h:1").message).toBe(
+      "cannot listen on h:1: listen EINVAL",
+    );
+  });
+});
@@ -0,0 +1,484 @@
+import { afterAll, describe, expect, it } from "bun:test";
+import { mkdirSync, mkdtempSync, rmSync, writeFileSync } from "node:fs";
+import { tmpdir } from "node:os";
+import { join } from "node:path";
+import { DEFAULT_CSP } from "../server/csp";
+import {
+  changedOptions,
+  DEFAULT_HOST,
+  DEFAULT_PORT,
+  DEFAULT_RATE_BURST,
+  DEFAULT_RATE_LIMIT,
+  defaultConfigPath,
+  parseConfig,
+  parseDuration,
+  parseOptions,
+  parsePort,
+  UsageError,
+} from "../server/options";
+
+const dir = mkdtempSync(join(tmpdir(), "brainbout-test-"));
+
+afterAll(() => {
+  rmSync(dir, { recursive: true, force: true });
+});
+
+describe("parsePort", () => {
+  it("accepts the full port range", () => {
+    expect(parsePort("1")).toBe(1);
+    expect(parsePort("65535")).toBe(65_535);
+  });
+
+  it("accepts 0 for an OS-assigned port", () => {
+    expect(parsePort("0")).toBe(0);
+  });
+
+  it("rejects out-of-range and non-numeric values", () => {
+    for (const raw of ["65536", "-1", "80.5", "http", ""]) {
+      expect(() => parsePort(raw)).toThrow(UsageError);
+    }
+  });
+});
+
+describe("parseDuration", () => {
+  it("parses Go-style durations into milliseconds", () => {
+    expect(parseDuration("t", "0")).toBe(0);
+    expect(parseDuration("t", "250ms")).toBe(250);
+    expect(parseDuration("t", "90s")).toBe(90_000);
+    expect(parseDuration("t", "30m")).toBe(1_800_000);
+    expect(parseDuration("t", "1h30m")).toBe(5_400_000);
+    expect(parseDuration("t", "1.5s")).toBe(1500);
+  });
+
+  it("rejects anything else", () => {
+    for (const raw of ["", "30", "5d", "m", "1h 30m", "-5s", "10sx"]) {
+      expect(() => parseDuration("t", raw)).toThrow(UsageError);
+    }
+  });
+});
+
+describe("parseOptions", () => {
+  it("defaults to port 8960", () => {
+    expect(parseOptions([]).port).toBe(DEFAULT_PORT);
+  });
+
+  it("reads --port and -p", () => {
+    expect(parseOptions(["--port", "9000"]).port).toBe(9000);
+    expect(parseOptions(["-p", "0"]).port).toBe(0);
+  });
+
+  it("binds loopback unless --host is given", () => {
+    expect(parseOptions([]).host).toBe(DEFAULT_HOST);
+    expect(parseOptions(["--host", "0.0.0.0"]).host).toBe("0.0.0.0");
+  });
+
+  it("opens the browser unless told not to", () => {
+    expect(parseOptions([]).noBrowser).toBe(false);
+    expect(parseOptions(["--no-browser"]).noBrowser).toBe(true);
+  });
+
+  it("honours BRAINBOUT_NO_BROWSER", () => {
+    const on = { BRAINBOUT_NO_BROWSER: "1" };
+    expect(parseOptions([], on).noBrowser).toBe(true);
+    for (const value of ["", "0", "false"]) {
+      const off = { BRAINBOUT_NO_BROWSER: value };
+      expect(parseOptions([], off).noBrowser).toBe(false);
+    }
+  });
+
+  it("requires the TLS cert and key together", () => {
+    const opts = parseOptions(["--tls-cert", "c.pem", "--tls-key", "k.pem"]);
+    expect(opts.tlsCert).toBe("c.pem");
+    expect(opts.tlsKey).toBe("k.pem");
+    expect(() => parseOptions(["--tls-cert", "c.pem"])).toThrow(UsageError);
+    expect(() => parseOptions(["--tls-key", "k.pem"])).toThrow(UsageError);
+  });
+
+  it("reads --tls-self-signed", () => {
+    expect(parseOptions([]).tlsSelfSigned).toBe(false);
+    expect(parseOptions(["--tls-self-signed"]).tlsSelfSigned).toBe(true);
+  });
+
+  it("reads --strict-port", () => {
+    expect(parseOptions([]).strictPort).toBe(false);
+    expect(parseOptions(["--strict-port"]).strictPort).toBe(true);
+  });
+
+  it("reads and validates the log level and format", () => {
+    expect(parseOptions([]).logLevel).toBe("info");
+    expect(parseOptions([]).logFormat).toBe("text");
+    const opts = parseOptions(["--log-level", "debug", "--log-format", "json"]);
+    expect(opts.logLevel).toBe("debug");
+    expect(opts.logFormat).toBe("json");
+    expect(() => parseOptions(["--log-level", "loud"])).toThrow(UsageError);
+    expect(() => parseOptions(["--log-format", "xml"])).toThrow(UsageError);
+  });
+
+  it("reads --version", () => {
+    expect(parseOptions([]).version).toBe(false);
+    expect(parseOptions(["--version"]).version).toBe(true);
+  });
+
+  it("reads --dev-dir", () => {
+    expect(parseOptions([]).devDir).toBe("");
+    expect(parseOptions(["--dev-dir", "dist"]).devDir).toBe("dist");
+  });
+
+  it("reads --idle-timeout, off by default", () => {
+    expect(parseOptions([]).idleTimeout).toBe(0);
+    expect(parseOptions(["--idle-timeout", "30m"]).idleTimeout).toBe(
+      1_800_000,
+    );
+  });
+
+  it("reads --shutdown-timeout, 5s by default", () => {
+    expect(parseOptions([]).shutdownTimeout).toBe(5000);
+    expect(
+      parseOptions(["--shutdown-timeout", "30s"]).shutdownTimeout,
+    ).toBe(30_000);
+  });
+
+  it("reads --unix and --public-url", () => {
+    const opts = parseOptions([
+      "--unix",
+      "/run/brainbout.sock",
+      "--public-url",
+      "https://chess.example",
+    ]);
+    expect(opts.unix).toBe("/run/brainbout.sock");
+    expect(opts.publicUrl).toBe("https://chess.example");
+    expect(parseOptions([]).unix).toBe("");
+  });
+
+  it("wants an http(s) --public-url, and only with --unix", () => {
+    for (const bad of ["example.com:8080", "/app", "ftp://example.com"]) {
+      expect(() =>
+        parseOptions(["--unix", "s", "--public-url", bad]),
+      ).toThrow(UsageError);
+    }
+    expect(() =>
+      parseOptions(["--public-url", "https://chess.example"]),
+    ).toThrow(UsageError);
+    expect(
+      parseOptions(["--unix", "s", "--public-url", "http://localhost:8080/bb"])
+        .publicUrl,
+    ).toBe("http://localhost:8080/bb");
+  });
+
+  it("refuses --unix together with --port or --host", () => {
+    expect(() => parseOptions(["--unix", "s", "--port", "1"])).toThrow(
+      UsageError,
+    );
+    expect(() => parseOptions(["--unix", "s", "--host", "::"])).toThrow(
+      UsageError,
+    );
+  });
+
+  it("reads --access-log, off by default", () => {
+    expect(parseOptions([]).accessLog).toBe(false);
+    expect(parseOptions(["--access-log"]).accessLog).toBe(true);
+  });
+
+  it("reads the admin token from --admin-token or the environment", () => {
+    expect(parseOptions([]).adminToken).toBe("");
+    expect(parseOptions(["--admin-token", "a"]).adminToken).toBe("a");
+    const env = { BRAINBOUT_ADMIN_TOKEN: "b" };
+    expect(parseOptions([], env).adminToken).toBe("b");
+    expect(parseOptions(["--admin-token", "a"], env).adminToken).toBe("a");
+  });
+
+  it("enables mDNS only with --mdns", () => {
+    expect(parseOptions([]).mdns).toBe(false);
+    expect(parseOptions(["--mdns"]).mdns).toBe(true);
+  });
+
+  it("defaults --csp to the built-in policy, with \"\" turning it off", () => {
+    expect(parseOptions([]).csp).toBe(DEFAULT_CSP);
+    expect(parseOptions(["--csp", ""]).csp).toBe("");
+    expect(parseOptions(["--csp", "default-src *"]).csp).toBe("default-src *");
+  });
+
+  it("requires --auth-user and --auth-pass together", () => {
+    expect(() => parseOptions(["--auth-user", "kim"])).toThrow(UsageError);
+    expect(() => parseOptions(["--auth-pass", "pw"])).toThrow(UsageError);
+    const opts = parseOptions(["--auth-user", "kim", "--auth-pass", "pw"]);
+    expect([opts.authUser, opts.authPass]).toEqual(["kim", "pw"]);
+  });
+
+  it("reads the auth password from the environment", () => {
+    const env = { BRAINBOUT_AUTH_PASS: "env" };
+    expect(parseOptions(["--auth-user", "kim"], env).authPass).toBe("env");
+  });
+
+  it("parses the API rate limit", () => {
+    const opts = parseOptions([]);
+    expect([opts.rateLimit, opts.rateBurst]).toEqual([
+      DEFAULT_RATE_LIMIT,
+      DEFAULT_RATE_BURST,
+    ]);
+    const set = parseOptions(["--rate-limit", "0.5", "--rate-burst", "3"]);
+    expect([set.rateLimit, set.rateBurst]).toEqual([0.5, 3]);
+    const off = parseOptions(["--rate-limit", "0", "--rate-burst", "0"]);
+    expect(off.rateLimit).toBe(0);
+  });
+
+  it("turns rate limiting off by default behind --unix", () => {
+    expect(parseOptions(["--unix", "/tmp/bb.sock"]).rateLimit).toBe(0);
+    expect(
+      parseOptions(["--unix", "/tmp/bb.sock", "--rate-limit", "5"]).rateLimit,
+    ).toBe(5);
+  });
+
+  it("rejects bad rate limits", () => {
+    for (const argv of [
+      ["--rate-limit", "-1"],
+      ["--rate-limit", "fast"],
+      ["--rate-burst", ""],
+      ["--rate-burst", "0.5"],
+    ]) {
+      expect(() => parseOptions(argv)).toThrow(UsageError);
+    }
+  });
+
+  it("serves metrics only with --metrics", () => {
+    expect(parseOptions([]).metrics).toBe(false);
+    expect(parseOptions(["--metrics"]).metrics).toBe(true);
+  });
+
+  it("reads the browser command from --browser or the environment", () => {
+    expect(parseOptions([]).browser).toBe("");
+    const env = { BRAINBOUT_BROWSER: "firefox" };
+    expect(parseOptions([], env).browser).toBe("firefox");
+    expect(parseOptions(["--browser", "chrome %s"], env).browser).toBe(
+      "chrome %s",
+    );
+  });
+
+  it("accepts --open-path only for paths on this server", () => {
+    expect(parseOptions([]).openPath).toBe("/");
+    expect(parseOptions(["--open-path", "/games/lex.html?x=1"]).openPath).toBe(
+      "/games/lex.html?x=1",
+    );
+    for (const path of ["games", "//evil.example", "/\\evil", ""]) {
+      expect(() => parseOptions(["--open-path", path])).toThrow(UsageError);
+    }
+  });
+
+  it("collects repeated --cors-origin flags", () => {
+    expect(parseOptions([]).corsOrigins).toEqual([]);
+    expect(
+      parseOptions([
+        "--cors-origin",
+        "https://a.example",
+        "--cors-origin",
+        "http://localhost:5173",
+      ]).corsOrigins,
+    ).toEqual(["https://a.example", "http://localhost:5173"]);
+    expect(() =>
+      parseOptions(["--cors-origin", "https://a.example/app"]),
+    ).toThrow(UsageError);
+  });
+
+  it("keeps cross-origin isolation on unless --no-isolation", () => {
+    expect(parseOptions([]).noIsolation).toBe(false);
+    expect(parseOptions(["--no-isolation"]).noIsolation).toBe(true);
+  });
+
+  it("takes an --addr-file to publish the URL in", () => {
+    expect(parseOptions([]).addrFile).toBe("");
+    expect(parseOptions(["--addr-file", "/tmp/bb.addr"]).addrFile).toBe(
+      "/tmp/bb.addr",
+    );
+  });
+
+  it("logs only errors with --quiet, whatever --log-level says", () => {
+    expect(parseOptions(["--quiet"]).logLevel).toBe("error");
+    expect(parseOptions(["-q", "--log-level", "debug"]).logLevel).toBe(
+      "error",
+    );
+    expect(() => parseOptions(["-q", "--log-level", "loud"])).toThrow(
+      UsageError,
+    );
+  });
+
+  it("takes an --overlay-dir to layer over the assets", () => {
+    expect(parseOptions([]).overlayDir).toBe("");
+    expect(parseOptions(["--overlay-dir", "theme"]).overlayDir).toBe("theme");
+  });
+
+  it("reads connection timeouts within Bun's limits", () => {
+    const opts = parseOptions([]);
+    expect([opts.connTimeout, opts.wsTimeout]).toEqual([10_000, 120_000]);
+    const tuned = parseOptions(["--conn-timeout", "4m", "--ws-timeout", "0"]);
+    expect([tuned.connTimeout, tuned.wsTimeout]).toEqual([240_000, 0]);
+    for (const argv of [
+      ["--conn-timeout", "5m"],
+      ["--ws-timeout", "17m"],
+      ["--conn-timeout", "soon"],
+    ]) {
+      expect(() => parseOptions(argv)).toThrow(UsageError);
+    }
+  });
+
+  it("reports unknown flags as usage errors", () => {
+    expect(() => parseOptions(["--bogus"])).toThrow(UsageError);
+  });
+});
+
+describe("changedOptions", () => {
+  it("lists the options whose values differ", () => {
+    const before = parseOptions(["--cors-origin", "https://a.example"]);
+    expect(changedOptions(before, before)).toEqual([]);
+    const after = parseOptions([
+      "--cors-origin",
+      "https://b.example",
+      "--log-level",
+      "debug",
+      "-p",
+      "9000",
+    ]);
+    expect(changedOptions(before, after).sort()).toEqual([
+      "corsOrigins",
+      "logLevel",
+      "port",
+    ]);
+  });
+});
+
+describe("defaultConfigPath", () => {
+  it("prefers XDG_CONFIG_HOME, then ~/.config, then APPDATA", () => {
+    const env = { XDG_CONFIG_HOME: "/x", HOME: "/h", APPDATA: "/a" };
+    expect(defaultConfigPath(env)).toBe(join("/x", "brainbout", "config.toml"));
+    expect(defaultConfigPath({ ...env, XDG_CONFIG_HOME: "" })).toBe(
+      join("/h", ".config", "brainbout", "config.toml"),
+    );
+    expect(defaultConfigPath({ APPDATA: "/a" })).toBe(
+      join("/a", "brainbout", "config.toml"),
+    );
+    expect(defaultConfigPath({})).toBe("");
+  });
+});
+
+describe("parseConfig", () => {
+  it("reads TOML, taking numbers for string flags", () => {
+    const text = 'port = 8961\nhost = "0.0.0.0"\nno-browser = true\n';
+    expect(parseConfig("c.toml", text)).toEqual({
+      port: "8961",
+      host: "0.0.0.0",
+      "no-browser": true,
+    });
+  });
+
+  it("takes a list, or a single value, for repeatable flags", () => {
+    const text = 'cors-origin = ["https://a.example", "https://b.example"]\n';
+    expect(parseConfig("c.toml", text)).toEqual({
+      "cors-origin": ["https://a.example", "https://b.example"],
+    });
+    const json = '{"cors-origin": "https://a.example"}';
+    expect(parseConfig("c.json", json)).toEqual({
+      "cors-origin": ["https://a.example"],
+    });
+  });
+
+  it("reads JSON by extension", () => {
+    expect(parseConfig("c.json", '{"log-level": "debug"}')).toEqual({
+      "log-level": "debug",
+    });
+  });
+
+  it("reports unknown keys, wrong types and bad syntax", () => {
+    for (const [path, text, msg] of [
+      ["c.json", '{"prot": 1}', 'unknown key "prot"'],
+      ["c.json", '{"version": true}', 'unknown key "version"'],
+      ["c.json", '{"toString": 1}', 'unknown key "toString"'],
+      ["c.json", '{"mdns": "yes"}', '"mdns" wants a boolean'],
+      ["c.json", '{"host": null}', '"host" wants a string'],
+      ["c.json", '{"host": ["a"]}', '"host" wants a string'],
+      [
+        "c.json",
+        '{"cors-origin": [1, true]}',
+        '"cors-origin" wants a string',
+      ],
+      ["c.json", "[]", "want a table"],
+      ["c.json", "{", "config c.json:"],
+    ] as const) {
+      expect(() => parseConfig(path, text)).toThrow(msg);
+    }
+  });
+});
+
+describe("parseOptions with a config file", () => {
+  const path = join(dir, "config.json");
+  writeFileSync(
+    path,
+    JSON.stringify({ port: 9000, "no-browser": true, "admin-token": "f" }),
+  );
+
+  it("seeds values that flags and the environment override", () => {
+    const opts = parseOptions(["--config", path]);
+    expect([opts.port, opts.noBrowser, opts.adminToken]).toEqual([
+      9000,
+      true,
+      "f",
+    ]);
+    const env = { BRAINBOUT_NO_BROWSER: "0", BRAINBOUT_ADMIN_TOKEN: "e" };
+    const over = parseOptions(["--config", path, "-p", "9001"], env);
+    expect([over.port, over.noBrowser, over.adminToken]).toEqual([
+      9001,
+      false,
+      "e",
+    ]);
+  });
+
+  it("loads the default file when present", () => {
+    const xdg = join(dir, "xdg");
+    mkdirSync(join(xdg, "brainbout"), { recursive: true });
+    const env = { XDG_CONFIG_HOME: xdg };
+    expect(parseOptions([], env).port).toBe(DEFAULT_PORT);
+    writeFileSync(defaultConfigPath(env), "port = 9002\n");
+    expect(parseOptions([], env).port).toBe(9002);
+    expect(parseOptions(["--config", ""], env).port).toBe(DEFAULT_PORT);
+  });
+
+  it("turns off the file's switches with --no- flags", () => {
+    const file = join(dir, "switches.toml");
+    writeFileSync(file, "mdns = true\nmetrics = true\nno-isolation = true\n");
+    const on = parseOptions(["--config", file]);
+    expect([on.mdns, on.metrics, on.noIsolation]).toEqual([true, true, true]);
+    const off = parseOptions([
+      "--config",
+      file,
+      "--no-mdns",
+      "--no-metrics",
+      "--no-no-isolation",
+    ]);
+    expect([off.mdns, off.metrics, off.noIsolation]).toEqual([
+      false,
+      false,
+      false,
+    ]);
+    expect(parseOptions(["--no-mdns", "--mdns"]).mdns).toBe(true);
+    expect(() => parseOptions(["--no-port"])).toThrow(UsageError);
+  });
+
+  it("lets --unix or an address on the command line replace the file's", () => {
+    const file = join(dir, "addr.toml");
+    writeFileSync(file, 'port = 8961\nhost = "0.0.0.0"\n');
+    const sock = parseOptions(["--config", file, "--unix", "/run/bb.sock"]);
+    expect([sock.unix, sock.port, sock.host]).toEqual([
+      "/run/bb.sock",
+      DEFAULT_PORT,
+      DEFAULT_HOST,
+    ]);
+    writeFileSync(file, 'unix = "/run/bb.sock"\n');
+    const tcp = parseOptions(["--config", file, "-p", "9003"]);
+    expect([tcp.unix, tcp.port]).toEqual(["", 9003]);
+    expect(parseOptions(["--config", file]).unix).toBe("/run/bb.sock");
+  });
+
+  it("requires an explicit --config to exist", () => {
+    expect(() => parseOptions(["--config", join(dir, "nope.toml")])).toThrow(
+      UsageError,
+    );
+  });
+});
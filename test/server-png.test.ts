@@ -0,0 +1,37 @@
+import { describe, expect, it } from "bun:test";
+import { inflateSync } from "node:zlib";
+import { crc32, encodePng } from "../server/png";
+
+describe("crc32", () => {
+  it("matches the IEND chunk checksum", () => {
+    expect(crc32(new TextEncoder().encode("IEND"))).toBe(0xae426082);
+  });
+});
+
+describe("encodePng", () => {
+  const png = encodePng(2, 2, [Uint8Array.of(0, 255), Uint8Array.of(255, 0)]);
+  const view = new DataView(png.buffer, png.byteOffset);
+
+  it("starts with the signature and a greyscale header", () => {
+    expect([...png.subarray(0, 8)]).toEqual([
+      0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a,
+    ]);
+    expect(new TextDecoder().decode(png.subarray(12, 16))).toBe("IHDR");
+    expect([view.getUint32(16), view.getUint32(20), png[24], png[25]]).toEqual(
+      [2, 2, 8, 0],
+    );
+  });
+
+  it("stores unfiltered scanlines", () => {
+    const idat = 8 + 25;
+    const len = view.getUint32(idat);
+    const raw = inflateSync(png.subarray(idat + 8, idat + 8 + len));
+    expect([...raw]).toEqual([0, 0, 255, 0, 255, 0]);
+  });
+
+  it("ends with IEND", () => {
+    expect([...png.subarray(-12)]).toEqual([
+      0, 0, 0, 0, 0x49, 0x45, 0x4e, 0x44, 0xae, 0x42, 0x60, 0x82,
+    ]);
+  });
+});
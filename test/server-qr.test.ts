@@ -0,0 +1,96 @@
+import { describe, expect, it } from "bun:test";
+import {
+  eccCodewords,
+  encodeQr,
+  formatBits,
+  qrCode,
+  qrPng,
+  versionBits,
+} from "../server/qr";
+
+const LAN_URL = "http://192.168.1.20:8960/";
+
+describe("eccCodewords", () => {
+  it("matches the 1-M HELLO WORLD example", () => {
+    const data = [
+      32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17,
+    ];
+    expect(eccCodewords(data, 10)).toEqual([
+      196, 35, 39, 119, 235, 215, 231, 226, 93, 23,
+    ]);
+  });
+});
+
+describe("formatBits and versionBits", () => {
+  it("match the spec tables", () => {
+    expect(formatBits(0)).toBe(0b101010000010010);
+    expect(formatBits(5)).toBe(0b100000011001110);
+    expect(versionBits(7)).toBe(0b000111110010010100);
+  });
+});
+
+describe("encodeQr", () => {
+  it("picks the smallest version that fits", () => {
+    expect(encodeQr("hi")).toHaveLength(21);
+    expect(encodeQr(LAN_URL)).toHaveLength(25);
+  });
+
+  it("draws the three finder patterns", () => {
+    const m = encodeQr(LAN_URL);
+    const n = m.length;
+    for (const [x, y] of [
+      [0, 0],
+      [n - 7, 0],
+      [0, n - 7],
+    ] as const) {
+      expect(m[y]![x]).toBe(true);
+      expect(m[y + 1]![x + 1]).toBe(false);
+      expect(m[y + 3]![x + 3]).toBe(true);
+    }
+  });
+
+  it("writes version information from version 7", () => {
+    const m = encodeQr(LAN_URL + "x".repeat(90));
+    expect(m).toHaveLength(45);
+    const n = m.length;
+    const bits = versionBits(7);
+    for (let i = 0; i < 18; i++) {
+      const dark = ((bits >>> i) & 1) === 1;
+      expect(m[Math.floor(i / 3)]![n - 11 + (i % 3)]).toBe(dark);
+    }
+  });
+
+  it("rejects text beyond version 10", () => {
+    expect(() => encodeQr("x".repeat(214))).toThrow(RangeError);
+  });
+});
+
+describe("qrPng", () => {
+  it("renders with a quiet zone at 8 px per module", () => {
+    const png = qrPng(encodeQr("hi"));
+    const view = new DataView(png.buffer, png.byteOffset);
+    expect(view.getUint32(16)).toBe((21 + 8) * 8);
+    expect(view.getUint32(20)).toBe((21 + 8) * 8);
+  });
+});
+
+describe("qrCode", () => {
+  it("is 404 with nothing to share", async () => {
+    const res = await qrCode(() => "")(new Request("http://x/qr"));
+    expect(res.status).toBe(404);
+  });
+
+  it("serves the current target as a PNG", async () => {
+    let target = LAN_URL;
+    const handler = qrCode(() => target);
+    const first = await handler(new Request("http://x/qr"));
+    expect(first.headers.get("Content-Type")).toBe("image/png");
+    const a = new Uint8Array(await first.arrayBuffer());
+    expect([...a.subarray(1, 4)]).toEqual([0x50, 0x4e, 0x47]);
+    const again = await handler(new Request("http://x/qr"));
+    expect(new Uint8Array(await again.arrayBuffer())).toEqual(a);
+    target = "http://10.0.0.5:8960/";
+    const moved = await handler(new Request("http://x/qr"));
+    expect(new Uint8Array(await moved.arrayBuffer())).not.toEqual(a);
+  });
+});
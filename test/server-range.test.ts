@@ -0,0 +1,110 @@
+import { afterAll, describe, expect, it } from "bun:test";
+import { mkdtempSync, rmSync, writeFileSync } from "node:fs";
+import { tmpdir } from "node:os";
+import { join } from "node:path";
+import { withCompression } from "../server/compress";
+import { withEtag } from "../server/etag";
+import { assets } from "../server/handler";
+import { parseRange, withRanges } from "../server/range";
+import { useNativeGlobals } from "./native-globals";
+
+useNativeGlobals();
+
+const dir = mkdtempSync(join(tmpdir(), "brainbout-test-"));
+const WASM = Uint8Array.from({ length: 4096 }, (_, i) => (i * 7) % 256);
+writeFileSync(join(dir, "engine.wasm"), WASM);
+
+afterAll(() => {
+  rmSync(dir, { recursive: true, force: true });
+});
+
+describe("parseRange", () => {
+  it("reads start-end, open-ended and suffix ranges", () => {
+    expect(parseRange("bytes=0-9", 100)).toEqual({ start: 0, end: 9 });
+    expect(parseRange("bytes=90-", 100)).toEqual({ start: 90, end: 99 });
+    expect(parseRange("bytes=90-500", 100)).toEqual({ start: 90, end: 99 });
+    expect(parseRange("bytes=-10", 100)).toEqual({ start: 90, end: 99 });
+    expect(parseRange("bytes=-500", 100)).toEqual({ start: 0, end: 99 });
+  });
+
+  it("can't satisfy ranges past the end", () => {
+    expect(parseRange("bytes=100-", 100)).toBe("unsatisfiable");
+    expect(parseRange("bytes=500-", 100)).toBe("unsatisfiable");
+    expect(parseRange("bytes=-0", 100)).toBe("unsatisfiable");
+    expect(parseRange("bytes=-5", 0)).toBe("unsatisfiable");
+  });
+
+  it("ignores malformed, multiple and non-byte ranges", () => {
+    for (const header of [
+      "bytes=9-0",
+      "bytes=-",
+      "bytes=0-1,5-6",
+      "items=0-1",
+      "0-1",
+    ]) {
+      expect(parseRange(header, 100)).toBeNull();
+    }
+  });
+});
+
+describe("withRanges", () => {
+  // The order main uses: ranges outside tags outside compression.
+  const files = assets({ "/engine.wasm": join(dir, "engine.wasm") });
+  const handler = withRanges(withEtag(withCompression(files)));
+  const get = (headers: Record<string, string>): Promise<Response> =>
+    Promise.resolve(
+      handler(new Request("http://127.0.0.1:8960/engine.wasm", { headers })),
+    );
+
+  it("serves a byte range of an embedded asset as 206", async () => {
+    const res = await get({ Range: "bytes=1000-1999" });
+    expect(res.status).toBe(206);
+    expect(res.headers.get("Content-Range")).toBe("bytes 1000-1999/4096");
+    expect(res.headers.get("Content-Length")).toBe("1000");
+    expect(new Uint8Array(await res.arrayBuffer())).toEqual(
+      WASM.subarray(1000, 2000),
+    );
+  });
+
+  it("advertises ranges on full responses", async () => {
+    const res = await get({});
+    expect(res.status).toBe(200);
+    expect(res.headers.get("Accept-Ranges")).toBe("bytes");
+    expect((await res.arrayBuffer()).byteLength).toBe(4096);
+  });
+
+  it("honours If-Range only for the current tag", async () => {
+    const etag = (await get({})).headers.get("ETag")!;
+    const resumed = await get({ Range: "bytes=4000-", "If-Range": etag });
+    expect(resumed.status).toBe(206);
+    expect(resumed.headers.get("Content-Range")).toBe("bytes 4000-4095/4096");
+    const changed = await get({ Range: "bytes=4000-", "If-Range": '"old"' });
+    expect(changed.status).toBe(200);
+    expect((await changed.arrayBuffer()).byteLength).toBe(4096);
+  });
+
+  it("answers 416 past the end and 200 for ranges it ignores", async () => {
+    const past = await get({ Range: "bytes=5000-" });
+    expect(past.status).toBe(416);
+    expect(past.headers.get("Content-Range")).toBe("bytes */4096");
+    expect((await get({ Range: "bytes=0-1,5-6" })).status).toBe(200);
+  });
+
+  it("leaves HEAD, errors and compressed responses alone", async () => {
+    const range = { Range: "bytes=0-0" };
+    const head = await withRanges(() => new Response("x"))(
+      new Request("http://x/", { method: "HEAD", headers: range }),
+    );
+    expect(head.headers.has("Accept-Ranges")).toBe(false);
+    for (const res of [
+      new Response("x", { status: 404 }),
+      new Response("x", { headers: { "Content-Encoding": "br" } }),
+    ]) {
+      const out = await withRanges(() => res)(
+        new Request("http://x/", { headers: range }),
+      );
+      expect(out.status).toBe(res.status);
+      expect(out.headers.has("Content-Range")).toBe(false);
+    }
+  });
+});
@@ -0,0 +1,74 @@
+import { describe, expect, it } from "bun:test";
+import { createRateLimiter, withRateLimit } from "../server/ratelimit";
+
+function clock(): { now: () => number; advance: (ms: number) => void } {
+  let t = 0;
+  return {
+    now: () => t,
+    advance: (ms) => {
+      t += ms;
+    },
+  };
+}
+
+describe("createRateLimiter", () => {
+  it("allows a burst, then refills at the rate", () => {
+    const c = clock();
+    const limiter = createRateLimiter(2, 3, c.now);
+    expect([1, 2, 3].map(() => limiter.take("a"))).toEqual([0, 0, 0]);
+    expect(limiter.take("a")).toBe(1);
+    c.advance(500);
+    expect(limiter.take("a")).toBe(0);
+    expect(limiter.take("a")).toBe(1);
+  });
+
+  it("keeps clients apart", () => {
+    const limiter = createRateLimiter(1, 1, clock().now);
+    expect(limiter.take("a")).toBe(0);
+    expect(limiter.take("a")).toBe(1);
+    expect(limiter.take("b")).toBe(0);
+  });
+
+  it("reports longer waits for slow rates", () => {
+    const limiter = createRateLimiter(0.1, 1, clock().now);
+    limiter.take("a");
+    expect(limiter.take("a")).toBe(10);
+  });
+
+  it("evicts refilled buckets", () => {
+    const c = clock();
+    const limiter = createRateLimiter(1, 2, c.now);
+    limiter.take("idle");
+    c.advance(30_000);
+    limiter.take("busy");
+    expect(limiter.size()).toBe(2);
+    c.advance(30_000);
+    limiter.take("busy");
+    expect(limiter.size()).toBe(1);
+  });
+});
+
+describe("withRateLimit", () => {
+  const handler = withRateLimit(
+    () => new Response("ok"),
+    createRateLimiter(1, 1, clock().now),
+    (req) => req.headers.get("X-Ip") ?? "",
+  );
+  const get = (path: string): Promise<Response> =>
+    Promise.resolve(
+      handler(new Request(`http://x${path}`, { headers: { "X-Ip": "1" } })),
+    );
+
+  it("answers 429 with Retry-After once the bucket is empty", async () => {
+    expect((await get("/api/stats")).status).toBe(200);
+    const res = await get("/ws/live");
+    expect(res.status).toBe(429);
+    expect(res.headers.get("Retry-After")).toBe("1");
+  });
+
+  it("never limits other paths", async () => {
+    for (let i = 0; i < 5; i++) {
+      expect((await get("/index.html")).status).toBe(200);
+    }
+  });
+});
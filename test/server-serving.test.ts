@@ -0,0 +1,159 @@
+import { describe, expect, it } from "bun:test";
+import { connect } from "node:net";
+import { type ServerWebSocket, serve as listen } from "bun";
+import { withBasicAuth } from "../server/admin";
+import { type Handler, mux } from "../server/handler";
+import { createRateLimiter, withRateLimit } from "../server/ratelimit";
+import {
+  createServing,
+  type Serving,
+  type Upgrader,
+  upgrade,
+} from "../server/serving";
+import { createSocketRegistry } from "../server/sockets";
+import { useNativeGlobals } from "./native-globals";
+
+useNativeGlobals();
+
+const WS = { Upgrade: "websocket" };
+
+function get(path: string, headers: Record<string, string> = {}): Request {
+  return new Request(`http://127.0.0.1:8960${path}`, { headers });
+}
+
+function upgrader(accepts = true): Upgrader & { calls: number } {
+  const srv = {
+    calls: 0,
+    upgrade: () => {
+      srv.calls++;
+      return accepts;
+    },
+  };
+  return srv;
+}
+
+function serve(wrap: (app: Handler) => Handler = (app) => app): Serving {
+  const sockets = createSocketRegistry<ServerWebSocket<undefined>>();
+  const app = mux({ "/ws/livereload": upgrade }, () => new Response("page"));
+  return createServing(wrap(app), {
+    connTimeout: 10_000,
+    wsTimeout: 120_000,
+    sockets,
+    topic: "livereload",
+  });
+}
+
+describe("createServing", () => {
+  it("converts timeouts to Bun's whole seconds", () => {
+    const serving = serve();
+    expect(serving.idleTimeout).toBe(10);
+    expect(serving.websocket.idleTimeout).toBe(120);
+  });
+
+  it("answers ordinary requests through the handler", async () => {
+    const srv = upgrader();
+    const res = await serve().fetch(get("/"), srv);
+    expect(await res?.text()).toBe("page");
+    expect(srv.calls).toBe(0);
+  });
+
+  it("upgrades requests the handler approves", async () => {
+    const srv = upgrader();
+    expect(await serve().fetch(get("/ws/livereload", WS), srv)).toBe(
+      undefined,
+    );
+    expect(srv.calls).toBe(1);
+  });
+
+  it("answers 426 to requests that are not WebSocket handshakes", async () => {
+    const srv = upgrader();
+    const plain = await serve().fetch(get("/ws/livereload"), srv);
+    expect(plain?.status).toBe(426);
+    expect(srv.calls).toBe(0);
+    const failed = await serve().fetch(
+      get("/ws/livereload", WS),
+      upgrader(false),
+    );
+    expect(failed?.status).toBe(426);
+  });
+
+  it("refuses an unauthenticated upgrade with 401", async () => {
+    const srv = upgrader();
+    const serving = serve((app) => withBasicAuth(app, "me", "pw"));
+    const res = await serving.fetch(get("/ws/livereload", WS), srv);
+    expect(res?.status).toBe(401);
+    expect(srv.calls).toBe(0);
+    const authed = await serving.fetch(
+      get("/ws/livereload", { ...WS, Authorization: `Basic ${btoa("me:pw")}` }),
+      srv,
+    );
+    expect(authed).toBe(undefined);
+    expect(srv.calls).toBe(1);
+  });
+
+  it("rate limits upgrades", async () => {
+    const srv = upgrader();
+    const serving = serve((app) =>
+      withRateLimit(app, createRateLimiter(1, 1), () => "10.0.0.1"),
+    );
+    await serving.fetch(get("/ws/livereload", WS), srv);
+    const res = await serving.fetch(get("/ws/livereload", WS), srv);
+    expect(res?.status).toBe(429);
+    expect(srv.calls).toBe(1);
+  });
+
+  it("tracks open sockets and subscribes them to the topic", () => {
+    const sockets = createSocketRegistry<ServerWebSocket<undefined>>();
+    const serving = createServing(() => new Response(""), {
+      connTimeout: 0,
+      wsTimeout: 0,
+      sockets,
+      topic: "livereload",
+    });
+    const topics: string[] = [];
+    const ws = {
+      subscribe: (topic: string) => topics.push(topic),
+      close: () => {},
+    } as unknown as ServerWebSocket<undefined>;
+    void serving.websocket.open?.(ws);
+    expect(sockets.size()).toBe(1);
+    expect(topics).toEqual(["livereload"]);
+    void serving.websocket.close?.(ws, 1000, "");
+    expect(sockets.size()).toBe(0);
+  });
+});
+
+describe("createServing under Bun.serve", () => {
+  it("drops a client that never finishes its headers", async () => {
+    const server = listen({
+      port: 0,
+      hostname: "127.0.0.1",
+      ...createServing(() => new Response("ok"), {
+        connTimeout: 1000,
+        wsTimeout: 0,
+        sockets: createSocketRegistry<ServerWebSocket<undefined>>(),
+        topic: "livereload",
+      }),
+    });
+    try {
+      const closed = await new Promise<boolean>((resolve) => {
+        const sock = connect(server.port!, "127.0.0.1", () => {
+          sock.write("GET / HTTP/1.1\r\n");
+        });
+        // Bun checks timeouts every few seconds, so allow it some slack.
+        const timer = setTimeout(() => {
+          sock.destroy();
+          resolve(false);
+        }, 8000);
+        sock.on("error", () => {});
+        sock.on("close", () => {
+          clearTimeout(timer);
+          resolve(true);
+        });
+      });
+      expect(closed).toBe(true);
+    } finally {
+      void server.stop(true);
+    }
+  }, 10_000);
+});
@@ -0,0 +1,50 @@
+import { describe, expect, it } from "bun:test";
+import {
+  type Closable,
+  createSocketRegistry,
+  GOING_AWAY,
+} from "../server/sockets";
+
+function socket(
+  onClose: (ws: Closable) => void,
+): Closable & { closed: unknown[] } {
+  const ws = {
+    closed: [] as unknown[],
+    close: (code?: number, reason?: string) => {
+      ws.closed.push(code, reason);
+      onClose(ws);
+    },
+  };
+  return ws;
+}
+
+describe("createSocketRegistry", () => {
+  it("resolves at once with nothing open", async () => {
+    expect(await createSocketRegistry().closeAll("bye", 1000)).toBe(0);
+  });
+
+  it("sends going-away frames and waits for the sockets to close", async () => {
+    const sockets = createSocketRegistry();
+    const a = socket((ws) => {
+      sockets.delete(ws);
+    });
+    const b = socket((ws) => {
+      setTimeout(() => {
+        sockets.delete(ws);
+      }, 5);
+    });
+    sockets.add(a);
+    sockets.add(b);
+    expect(sockets.size()).toBe(2);
+    expect(await sockets.closeAll("server shutting down", 1000)).toBe(0);
+    expect(a.closed).toEqual([GOING_AWAY, "server shutting down"]);
+    expect(b.closed).toEqual([GOING_AWAY, "server shutting down"]);
+    expect(sockets.size()).toBe(0);
+  });
+
+  it("stops waiting after the timeout", async () => {
+    const sockets = createSocketRegistry();
+    sockets.add(socket(() => {}));
+    expect(await sockets.closeAll("bye", 5)).toBe(1);
+  });
+});
@@ -0,0 +1,24 @@
+import { describe, expect, it } from "bun:test";
+import { BUILD, versionString } from "../server/version";
+
+describe("BUILD", () => {
+  it("falls back to dev values when run from source", () => {
+    expect(BUILD).toEqual({ version: "dev", commit: "unknown", buildDate: "" });
+  });
+});
+
+describe("versionString", () => {
+  it("includes the commit and build date", () => {
+    expect(
+      versionString({
+        version: "1.0.0",
+        commit: "abc1234",
+        buildDate: "2026-01-01T00:00:00.000Z",
+      }),
+    ).toBe("brainbout 1.0.0 (commit abc1234, built 2026-01-01T00:00:00.000Z)");
+  });
+
+  it("omits a missing build date", () => {
+    expect(versionString(BUILD)).toBe("brainbout dev (commit unknown)");
+  });
+});